@@ -4,7 +4,9 @@ go 1.12
 
 require (
 	cirello.io/dynamolock v1.3.1
-	github.com/aws/aws-sdk-go v1.23.13
+	github.com/aws/aws-sdk-go v1.30.14
 	github.com/urfave/cli v1.21.0
-	golang.org/x/xerrors v0.0.0-20190717185122-a985d3407aa7
+	golang.org/x/xerrors v0.0.0-20191011141410-1b5146add898
 )
+
+replace cirello.io/dynamolock => ../../../
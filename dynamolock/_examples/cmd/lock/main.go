@@ -2,10 +2,12 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"log"
 	"os"
 	"os/exec"
 	"os/signal"
+	"text/tabwriter"
 	"time"
 
 	"cirello.io/dynamolock"
@@ -13,6 +15,7 @@ import (
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
 	"github.com/urfave/cli"
 	"golang.org/x/xerrors"
 )
@@ -42,7 +45,7 @@ func main() {
 			return xerrors.New("missing command")
 		}
 		tableName := c.String("table")
-		client, err := dialDynamoDB(tableName)
+		client, _, err := dialDynamoDB(tableName)
 		if err != nil {
 			return err
 		}
@@ -63,27 +66,126 @@ func main() {
 		}()
 		return runCommand(ctx, lock, c.Bool("release-on-error"), cmd)
 	}
+	app.Commands = []cli.Command{
+		{
+			Name:  "list",
+			Usage: "list the locks in the table",
+			Flags: []cli.Flag{
+				cli.StringFlag{Name: "owner", Usage: "only list locks held by this owner"},
+				cli.BoolFlag{Name: "expired", Usage: "only list locks that appear expired"},
+			},
+			Action: func(c *cli.Context) error {
+				client, _, err := dialDynamoDB(c.GlobalString("table"))
+				if err != nil {
+					return err
+				}
+				owner, expired := c.String("owner"), c.Bool("expired")
+				locks, err := client.List(context.Background(), func(l *dynamolock.LockInfo) bool {
+					return (owner == "" || l.OwnerName == owner) && (!expired || l.AppearsExpired)
+				})
+				if err != nil {
+					return xerrors.Errorf("cannot list locks: %w", err)
+				}
+				w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+				fmt.Fprintln(w, "KEY\tOWNER\tLEASE\tLAST UPDATED\tEXPIRED\tDATA")
+				for _, l := range locks {
+					fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%t\t%q\n", l.Key, l.OwnerName,
+						l.LeaseDuration, formatTime(l.LastUpdated), l.AppearsExpired, l.Data)
+				}
+				return w.Flush()
+			},
+		},
+		{
+			Name:      "inspect",
+			Usage:     "show the details of a lock",
+			ArgsUsage: "lock-name",
+			Action: func(c *cli.Context) error {
+				lockName := c.Args().First()
+				if lockName == "" {
+					return xerrors.New("missing lock name")
+				}
+				client, _, err := dialDynamoDB(c.GlobalString("table"))
+				if err != nil {
+					return err
+				}
+				lock, err := client.GetWithContext(context.Background(), lockName)
+				if err != nil {
+					return xerrors.Errorf("cannot inspect lock: %w", err)
+				}
+				if lock.OwnerName() == "" {
+					return xerrors.Errorf("lock %s not found", lockName)
+				}
+				l := lock.Info()
+				fmt.Println("key:", l.Key)
+				fmt.Println("owner:", l.OwnerName)
+				fmt.Println("lease duration:", l.LeaseDuration)
+				fmt.Println("last updated:", formatTime(l.LastUpdated))
+				fmt.Println("released:", l.IsReleased)
+				fmt.Println("appears expired:", l.AppearsExpired)
+				fmt.Println("fencing token:", l.FencingToken)
+				fmt.Printf("data: %q\n", l.Data)
+				for k, v := range l.AdditionalAttributes {
+					fmt.Printf("attribute %s: %s\n", k, v)
+				}
+				return nil
+			},
+		},
+		{
+			Name:      "force-release",
+			Usage:     "delete a lock regardless of its owner",
+			ArgsUsage: "lock-name",
+			Action: func(c *cli.Context) error {
+				lockName := c.Args().First()
+				if lockName == "" {
+					return xerrors.New("missing lock name")
+				}
+				tableName := c.GlobalString("table")
+				_, svc, err := dialDynamoDB(tableName)
+				if err != nil {
+					return err
+				}
+				_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+					TableName: aws.String(tableName),
+					Key: map[string]*dynamodb.AttributeValue{
+						"key": {S: aws.String(lockName)},
+					},
+				})
+				if err != nil {
+					return xerrors.Errorf("cannot release lock %s: %w", lockName, err)
+				}
+				return nil
+			},
+		},
+	}
 	if err := app.Run(os.Args); err != nil {
 		log.Fatal(err)
 	}
 }
 
-func dialDynamoDB(tableName string) (*dynamolock.Client, error) {
+func dialDynamoDB(tableName string) (*dynamolock.Client, dynamodbiface.DynamoDBAPI, error) {
 	session, err := session.NewSession()
 	if err != nil {
-		return nil, xerrors.Errorf("cannot create AWS session: %w", err)
+		return nil, nil, xerrors.Errorf("cannot create AWS session: %w", err)
 	}
+	svc := dynamodb.New(session)
 	client, err := dynamolock.New(
-		dynamodb.New(session),
+		svc,
 		tableName,
 		dynamolock.WithLeaseDuration(3*time.Second),
 		dynamolock.WithHeartbeatPeriod(1*time.Second),
 		dynamolock.WithPartitionKeyName("key"),
 	)
 	if err != nil {
-		return nil, xerrors.Errorf("cannot start dynamolock client: %w", err)
+		return nil, nil, xerrors.Errorf("cannot start dynamolock client: %w", err)
+	}
+	return client, svc, nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "unknown"
 	}
-	return client, nil
+	return t.Local().Format(time.RFC3339)
 }
 
 func createTable(client *dynamolock.Client, tableName string) error {
@@ -24,6 +24,8 @@ import (
 	"io/ioutil"
 	"log"
 	"math/big"
+	"strconv"
+	"strings"
 	"sync"
 	"time"
 
@@ -35,11 +37,19 @@ import (
 const (
 	dataPathExpressionVariable               = "#d"
 	dataValueExpressionVariable              = ":d"
+	skPathExpressionVariable                 = "#sk"
+	skValueExpressionVariable                = ":sk"
+	expiryPathExpressionVariable             = "#ex"
+	expiryValueExpressionVariable            = ":ex"
+	fencingTokenPathExpressionVariable       = "#ft"
+	fencingTokenValueExpressionVariable      = ":ft"
 	isReleasedPathExpressionVariable         = "#ir"
 	isReleasedValue                          = "1"
 	isReleasedValueExpressionVariable        = ":ir"
 	leaseDurationPathValueExpressionVariable = "#ld"
 	leaseDurationValueExpressionVariable     = ":ld"
+	lastUpdatedPathExpressionVariable        = "#lu"
+	lastUpdatedValueExpressionVariable       = ":lu"
 	newRvnValueExpressionVariable            = ":newRvn"
 	ownerNamePathExpressionVariable          = "#on"
 	ownerNameValueExpressionVariable         = ":on"
@@ -52,6 +62,8 @@ const (
 	attrLeaseDuration       = "leaseDuration"
 	attrRecordVersionNumber = "recordVersionNumber"
 	attrIsReleased          = "isReleased"
+	attrFencingToken        = "fencingToken"
+	attrLastUpdated         = "lastUpdated"
 
 	defaultBuffer = 1 * time.Second
 )
@@ -60,29 +72,64 @@ var (
 	pkExistsAndOwnerNameSameAndRvnSameCondition = fmt.Sprintf("%s AND %s = %s",
 		pkExistsAndRvnIsTheSameCondition, ownerNamePathExpressionVariable, ownerNameValueExpressionVariable)
 
-	updateLeaseDurationAndRvnAndRemoveData = fmt.Sprintf("%s REMOVE %s",
-		updateLeaseDurationAndRvn, dataPathExpressionVariable)
-
-	updateLeaseDurationAndRvnAndData = fmt.Sprintf("%s, %s = %s",
-		updateLeaseDurationAndRvn, dataPathExpressionVariable, dataValueExpressionVariable)
-
 	updateLeaseDurationAndRvn = fmt.Sprintf(
-		"SET %s = %s, %s = %s",
+		"SET %s = %s, %s = %s, %s = %s",
 		leaseDurationPathValueExpressionVariable, leaseDurationValueExpressionVariable,
-		rvnPathExpressionVariable, newRvnValueExpressionVariable)
+		rvnPathExpressionVariable, newRvnValueExpressionVariable,
+		lastUpdatedPathExpressionVariable, lastUpdatedValueExpressionVariable)
 
 	updateIsReleasedAndData = fmt.Sprintf("%s, %s = %s",
 		updateIsReleased, dataPathExpressionVariable, dataValueExpressionVariable)
 
-	updateIsReleased = fmt.Sprintf("SET %s = %s", isReleasedPathExpressionVariable, isReleasedValueExpressionVariable)
+	updateIsReleased = fmt.Sprintf("SET %s = %s, %s = %s",
+		isReleasedPathExpressionVariable, isReleasedValueExpressionVariable,
+		lastUpdatedPathExpressionVariable, lastUpdatedValueExpressionVariable)
 )
 
 var isReleasedAttributeValue = &dynamodb.AttributeValue{S: aws.String(isReleasedValue)}
+
+// expiryAttributeValue encodes the time after which a lock item updated at t
+// can be garbage collected.
+func (c *Client) expiryAttributeValue(t time.Time) *dynamodb.AttributeValue {
+	expiry := t.Add(c.leaseDuration + c.expiryGracePeriod)
+	return &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(expiry.Unix(), 10))}
+}
+
+// withExpiry appends to the SET clause of an update expression the refresh
+// of the expiry attribute, when the client maintains one.
+func (c *Client) withExpiry(setExpression string, t time.Time, names map[string]*string, values map[string]*dynamodb.AttributeValue) string {
+	if c.expiryAttribute == "" {
+		return setExpression
+	}
+	names[expiryPathExpressionVariable] = aws.String(c.expiryAttribute)
+	values[expiryValueExpressionVariable] = c.expiryAttributeValue(t)
+	return fmt.Sprintf("%s, %s = %s", setExpression, expiryPathExpressionVariable, expiryValueExpressionVariable)
+}
+
+// lastUpdatedAttributeValue encodes the time of a change in the lock item. It
+// is informative only: lock expiration never relies on absolute times.
+func lastUpdatedAttributeValue(t time.Time) *dynamodb.AttributeValue {
+	return &dynamodb.AttributeValue{S: aws.String(t.UTC().Format(time.RFC3339Nano))}
+}
+
+var sortKeyIsTheSameCondition = fmt.Sprintf("%s = %s", skPathExpressionVariable, skValueExpressionVariable)
+
 var acquireLockThatDoesntExistOrIsReleasedCondition = fmt.Sprintf(
 	"attribute_not_exists(%s) OR (attribute_exists(%s) AND %s = %s)",
 	pkPathExpressionVariable, pkPathExpressionVariable,
 	isReleasedPathExpressionVariable, isReleasedValueExpressionVariable)
 
+// The fencing token is computed from the lock item read before the write, so
+// the conditional put must also guarantee that no one else acquired (and
+// released) the lock in between; otherwise two owners could be handed the
+// same token.
+var (
+	fencingTokenIsTheSameCondition = fmt.Sprintf("%s = %s",
+		fencingTokenPathExpressionVariable, fencingTokenValueExpressionVariable)
+	fencingTokenDoesntExistCondition = fmt.Sprintf("attribute_not_exists(%s)",
+		fencingTokenPathExpressionVariable)
+)
+
 // Logger defines the minimum desired logger interface for the lock client.
 type Logger interface {
 	Println(v ...interface{})
@@ -94,16 +141,27 @@ type Client struct {
 
 	tableName        string
 	partitionKeyName string
+	sortKeyName      string
+	sortKey          string
 
 	leaseDuration               time.Duration
 	heartbeatPeriod             time.Duration
 	ownerName                   string
 	locks                       sync.Map
+	leases                      sync.Map
 	sessionMonitorCancellations sync.Map
 
-	logger Logger
+	logger   Logger
+	observer Observer
+
+	expiryAttribute   string
+	expiryGracePeriod time.Duration
 
-	stopHeartbeat context.CancelFunc
+	heartbeatContext       context.Context
+	stopHeartbeat          context.CancelFunc
+	heartbeats             sync.WaitGroup
+	maxConcurrentHeartbeat int
+	heartbeatSlots         chan struct{}
 
 	mu        sync.RWMutex
 	closeOnce sync.Once
@@ -114,6 +172,8 @@ const (
 	defaultPartitionKeyName = "key"
 	defaultLeaseDuration    = 20 * time.Second
 	defaultHeartbeatPeriod  = 5 * time.Second
+
+	defaultMaxConcurrentHeartbeat = 10
 )
 
 // New creates a new dynamoDB based distributed lock client.
@@ -126,7 +186,9 @@ func New(dynamoDB dynamodbiface.DynamoDBAPI, tableName string, opts ...ClientOpt
 		heartbeatPeriod:  defaultHeartbeatPeriod,
 		ownerName:        randString(32),
 		logger:           log.New(ioutil.Discard, "", 0),
-		stopHeartbeat:    func() {},
+		observer:         NopObserver{},
+
+		maxConcurrentHeartbeat: defaultMaxConcurrentHeartbeat,
 	}
 
 	for _, opt := range opts {
@@ -139,11 +201,20 @@ func New(dynamoDB dynamodbiface.DynamoDBAPI, tableName string, opts ...ClientOpt
 			"4+ times greater)")
 	}
 
-	if c.heartbeatPeriod > 0 {
-		ctx, cancel := context.WithCancel(context.Background())
-		c.stopHeartbeat = cancel
-		go c.heartbeat(ctx)
+	if c.observer == nil {
+		c.observer = NopObserver{}
+	}
+
+	if c.sortKeyName != "" && c.sortKey == "" {
+		return nil, errors.New("sort key value must not be empty")
+	}
+
+	if c.maxConcurrentHeartbeat < 1 {
+		return nil, errors.New("at least one concurrent heartbeat must be allowed")
 	}
+
+	c.heartbeatContext, c.stopHeartbeat = context.WithCancel(context.Background())
+	c.heartbeatSlots = make(chan struct{}, c.maxConcurrentHeartbeat)
 	return c, nil
 }
 
@@ -155,6 +226,18 @@ func WithPartitionKeyName(s string) ClientOption {
 	return func(c *Client) { c.partitionKeyName = s }
 }
 
+// WithSortKey makes the client store its locks under the given value of the
+// sort key named name, so several clients can share one table, each in its
+// own namespace: the same lock key means different locks for clients with
+// different sort key values. The table must have been created with the same
+// sort key (see WithCustomSortKeyName).
+func WithSortKey(name, value string) ClientOption {
+	return func(c *Client) {
+		c.sortKeyName = name
+		c.sortKey = value
+	}
+}
+
 // WithOwnerName changes the owner linked to the client, and by consequence to
 // locks.
 func WithOwnerName(s string) ClientOption {
@@ -173,12 +256,34 @@ func WithHeartbeatPeriod(d time.Duration) ClientOption {
 	return func(c *Client) { c.heartbeatPeriod = d }
 }
 
+// WithMaxConcurrentHeartbeats defines how many heartbeats can be in flight at
+// the same time. Each lock is heartbeated on its own schedule, and this option
+// bounds how many of them are sent to DynamoDB concurrently.
+func WithMaxConcurrentHeartbeats(n int) ClientOption {
+	return func(c *Client) { c.maxConcurrentHeartbeat = n }
+}
+
 // DisableHeartbeat disables automatic hearbeats. Use SendHeartbeat to freshen
 // up the lock.
 func DisableHeartbeat() ClientOption {
 	return WithHeartbeatPeriod(0)
 }
 
+// WithExpiryAttribute makes the client store in the given attribute the Unix
+// time, in seconds, after which the lock item can be considered abandoned:
+// the end of the lease plus the grace period. It is updated on every
+// acquisition and heartbeat. Combined with a table whose time to live is
+// enabled on the same attribute (see WithTimeToLive), DynamoDB eventually
+// deletes the items of locks that were not deleted on release or whose owners
+// crashed. The items that count fencing tokens are kept on purpose, so tokens
+// never go back to the start (see Lock.FencingToken).
+func WithExpiryAttribute(attributeName string, gracePeriod time.Duration) ClientOption {
+	return func(c *Client) {
+		c.expiryAttribute = attributeName
+		c.expiryGracePeriod = gracePeriod
+	}
+}
+
 // WithLogger injects a logger into the client, so its internals can be
 // recorded.
 func WithLogger(l Logger) ClientOption {
@@ -279,8 +384,28 @@ func WithSessionMonitor(safeTime time.Duration, callback func()) AcquireLockOpti
 	}
 }
 
+// WithHeartbeatErrorHandler registers a callback that is called whenever an
+// automatic heartbeat of the lock fails. If the error is a
+// LockNotGrantedError, the lock has been lost and no further heartbeats are
+// going to be attempted; otherwise, the heartbeat is retried after the refresh
+// period (see WithRefreshPeriod). The callback is run from the heartbeat
+// goroutine of the lock, therefore it must not block.
+func WithHeartbeatErrorHandler(f func(error)) AcquireLockOption {
+	return func(opt *acquireLockOptions) {
+		opt.heartbeatErrorHandler = f
+	}
+}
+
 // AcquireLock holds the defined lock.
 func (c *Client) AcquireLock(key string, opts ...AcquireLockOption) (*Lock, error) {
+	return c.AcquireLockWithContext(context.Background(), key, opts...)
+}
+
+// AcquireLockWithContext holds the defined lock. The given context is passed
+// down to the underlying dynamoDB calls and it also interrupts the wait for the
+// lock. If the context is done before the lock is granted, it returns a
+// LockNotGrantedError whose cause is the context error.
+func (c *Client) AcquireLockWithContext(ctx context.Context, key string, opts ...AcquireLockOption) (*Lock, error) {
 	if c.isClosed() {
 		return nil, ErrClientClosed
 	}
@@ -290,10 +415,10 @@ func (c *Client) AcquireLock(key string, opts ...AcquireLockOption) (*Lock, erro
 	for _, opt := range opts {
 		opt(req)
 	}
-	return c.acquireLock(req)
+	return c.acquireLock(ctx, req)
 }
 
-func (c *Client) acquireLock(opt *acquireLockOptions) (*Lock, error) {
+func (c *Client) acquireLock(ctx context.Context, opt *acquireLockOptions) (_ *Lock, err error) {
 	// Hold the read lock when acquiring locks. This prevents us from
 	// acquiring a lock while the Client is being closed as we hold the
 	// write lock during close.
@@ -302,8 +427,40 @@ func (c *Client) acquireLock(opt *acquireLockOptions) (*Lock, error) {
 	if c.closed {
 		return nil, ErrClientClosed
 	}
+	start := time.Now()
+	defer func() {
+		c.observeAcquisition(opt.partitionKey, start, err)
+	}()
 
-	attrs := opt.additionalAttributes
+	if err := checkKey(opt.partitionKey); err != nil {
+		return nil, err
+	}
+	if err := c.checkAdditionalAttributes(opt.additionalAttributes); err != nil {
+		return nil, err
+	}
+	getLockOptions := newGetLockOptions(opt, opt.partitionKey, start)
+	for {
+		l, err := c.storeLock(ctx, &getLockOptions)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctxLockNotGrantedError(ctx)
+		} else if err != nil {
+			return nil, err
+		} else if l != nil {
+			c.startHeartbeat(l, getLockOptions.refreshPeriodDuration, opt.heartbeatErrorHandler)
+			return l, nil
+		}
+		c.logger.Println("Sleeping for a refresh period of ", getLockOptions.refreshPeriodDuration)
+		select {
+		case <-ctx.Done():
+			return nil, ctxLockNotGrantedError(ctx)
+		case <-time.After(getLockOptions.refreshPeriodDuration):
+		}
+	}
+}
+
+// checkAdditionalAttributes refuses additional attributes that would
+// overwrite the ones managed by the client.
+func (c *Client) checkAdditionalAttributes(attrs map[string]*dynamodb.AttributeValue) error {
 	contains := func(ks ...string) bool {
 		for _, k := range ks {
 			if _, ok := attrs[k]; ok {
@@ -313,20 +470,30 @@ func (c *Client) acquireLock(opt *acquireLockOptions) (*Lock, error) {
 		return false
 	}
 
-	if contains(c.partitionKeyName, attrOwnerName, attrLeaseDuration,
-		attrRecordVersionNumber, attrData) {
-		return nil, fmt.Errorf("additional attribute cannot be one of the following types: %s, %s, %s, %s, %s",
-			c.partitionKeyName, attrOwnerName, attrLeaseDuration, attrRecordVersionNumber, attrData)
+	reserved := []string{c.partitionKeyName, attrOwnerName, attrLeaseDuration,
+		attrRecordVersionNumber, attrData, attrFencingToken, attrLastUpdated}
+	if c.sortKeyName != "" {
+		reserved = append(reserved, c.sortKeyName)
+	}
+	if c.expiryAttribute != "" {
+		reserved = append(reserved, c.expiryAttribute)
 	}
+	if contains(reserved...) {
+		return fmt.Errorf("additional attribute cannot be one of the following types: %s",
+			strings.Join(reserved, ", "))
+	}
+	return nil
+}
 
+func newGetLockOptions(opt *acquireLockOptions, key string, start time.Time) getLockOptions {
 	getLockOptions := getLockOptions{
-		partitionKeyName:     opt.partitionKey,
+		partitionKeyName:     key,
 		deleteLockOnRelease:  opt.deleteLockOnRelease,
 		sessionMonitor:       opt.sessionMonitor,
-		start:                time.Now(),
+		start:                start,
 		replaceData:          opt.replaceData,
 		data:                 opt.data,
-		additionalAttributes: attrs,
+		additionalAttributes: opt.additionalAttributes,
 		failIfLocked:         opt.failIfLocked,
 	}
 
@@ -339,72 +506,85 @@ func (c *Client) acquireLock(opt *acquireLockOptions) (*Lock, error) {
 	if opt.refreshPeriod > 0 {
 		getLockOptions.refreshPeriodDuration = opt.refreshPeriod
 	}
+	return getLockOptions
+}
 
-	for {
-		l, err := c.storeLock(&getLockOptions)
-		if err != nil {
-			return nil, err
-		} else if l != nil {
-			return l, nil
+// Do executes f while holding the lock for the given key. While f runs, the
+// lock is kept heartbeated and the context passed on to f is canceled when
+// either a heartbeat fails or the session monitor (see WithSessionMonitor)
+// detects that the lock entered the danger zone. The lock is always released
+// when f returns; if that fails, the release error is returned when f
+// succeeded, and logged otherwise.
+func (c *Client) Do(ctx context.Context, key string, f func(context.Context, *Lock) error, opts ...AcquireLockOption) (err error) {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	req := &acquireLockOptions{
+		partitionKey: key,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+	if sm := req.sessionMonitor; sm != nil {
+		callback := sm.callback
+		req.sessionMonitor = &sessionMonitor{
+			safeTime: sm.safeTime,
+			callback: func() {
+				cancel()
+				if callback != nil {
+					callback()
+				}
+			},
 		}
-		c.logger.Println("Sleeping for a refresh period of ", getLockOptions.refreshPeriodDuration)
-		time.Sleep(getLockOptions.refreshPeriodDuration)
 	}
+	heartbeatErrorHandler := req.heartbeatErrorHandler
+	req.heartbeatErrorHandler = func(err error) {
+		cancel()
+		if heartbeatErrorHandler != nil {
+			heartbeatErrorHandler(err)
+		}
+	}
+	l, err := c.acquireLock(ctx, req)
+	if err != nil {
+		return err
+	}
+	defer func() {
+		if _, releaseErr := c.ReleaseLock(l); releaseErr != nil {
+			if err == nil {
+				err = releaseErr
+				return
+			}
+			c.logger.Println("cannot release lock", key, "after Do:", releaseErr)
+		}
+	}()
+	return f(ctx, l)
 }
 
-func (c *Client) storeLock(getLockOptions *getLockOptions) (*Lock, error) {
+func (c *Client) storeLock(ctx context.Context, getLockOptions *getLockOptions) (*Lock, error) {
 	c.logger.Println("Call GetItem to see if the lock for ",
 		c.partitionKeyName, " =", getLockOptions.partitionKeyName, " exists in the table")
-	existingLock, err := c.getLockFromDynamoDB(*getLockOptions)
+	existingLock, err := c.getLockFromDynamoDB(ctx, *getLockOptions)
 	if err != nil {
 		return nil, err
 	}
-
-	var newLockData []byte
-	if getLockOptions.replaceData {
-		newLockData = getLockOptions.data
-	} else if existingLock != nil {
-		newLockData = existingLock.data
-	}
-
-	if newLockData == nil {
-		// If there is no existing data, we write the input data to the lock.
-		newLockData = getLockOptions.data
-	}
-
-	mergedAdditionalAttributes := make(map[string]*dynamodb.AttributeValue)
-	for k, v := range existingLock.AdditionalAttributes() {
-		mergedAdditionalAttributes[k] = v
-	}
-	for k, v := range getLockOptions.additionalAttributes {
-		mergedAdditionalAttributes[k] = v
-	}
-	getLockOptions.additionalAttributes = mergedAdditionalAttributes
-
-	item := make(map[string]*dynamodb.AttributeValue)
-	for k, v := range getLockOptions.additionalAttributes {
-		item[k] = v
-	}
-	item[c.partitionKeyName] = &dynamodb.AttributeValue{S: aws.String(getLockOptions.partitionKeyName)}
-	item[attrOwnerName] = &dynamodb.AttributeValue{S: aws.String(c.ownerName)}
-	item[attrLeaseDuration] = &dynamodb.AttributeValue{S: aws.String(c.leaseDuration.String())}
-
-	recordVersionNumber := c.generateRecordVersionNumber()
-	item[attrRecordVersionNumber] = &dynamodb.AttributeValue{S: aws.String(recordVersionNumber)}
-
-	if newLockData != nil {
-		item[attrData] = &dynamodb.AttributeValue{B: newLockData}
+	fencingCounter, err := c.fencingCounterFor(ctx, getLockOptions.partitionKeyName, existingLock)
+	if err != nil {
+		return nil, err
 	}
+	fencingToken := fencingCounter.next()
+	item, newLockData, recordVersionNumber := c.draftLockItem(getLockOptions, existingLock, fencingToken)
 
 	//if the existing lock does not exist or exists and is released
 	if existingLock == nil || existingLock.isReleased {
 		l, err := c.upsertAndMonitorNewOrReleasedLock(
+			ctx,
 			getLockOptions.additionalAttributes,
 			getLockOptions.partitionKeyName,
 			getLockOptions.deleteLockOnRelease,
-			newLockData,
-			item,
-			recordVersionNumber,
+			existingLock, newLockData, item,
+			recordVersionNumber, fencingCounter, fencingToken,
 			getLockOptions.sessionMonitor)
 		if err != nil && isLockNotGrantedError(err) {
 			return nil, nil
@@ -436,11 +616,12 @@ func (c *Client) storeLock(getLockOptions *getLockOptions) (*Lock, error) {
 	} else if getLockOptions.lockTryingToBeAcquired.recordVersionNumber == existingLock.recordVersionNumber && getLockOptions.lockTryingToBeAcquired.isExpired() {
 		/* If the version numbers match, then we can acquire the lock, assuming it has already expired */
 		l, err := c.upsertAndMonitorExpiredLock(
+			ctx,
 			getLockOptions.additionalAttributes,
 			getLockOptions.partitionKeyName,
 			getLockOptions.deleteLockOnRelease,
 			existingLock, newLockData, item,
-			recordVersionNumber,
+			recordVersionNumber, fencingCounter, fencingToken,
 			getLockOptions.sessionMonitor)
 		if err != nil && isLockNotGrantedError(err) {
 			return nil, nil
@@ -463,11 +644,63 @@ func (c *Client) storeLock(getLockOptions *getLockOptions) (*Lock, error) {
 	return nil, nil
 }
 
+// draftLockItem prepares the lock item that replaces existingLock, which is
+// nil when there is no lock item yet. The additional attributes of the
+// existing lock are merged into getLockOptions.
+func (c *Client) draftLockItem(getLockOptions *getLockOptions, existingLock *Lock, fencingToken int64) (
+	map[string]*dynamodb.AttributeValue, []byte, string) {
+	var newLockData []byte
+	if getLockOptions.replaceData {
+		newLockData = getLockOptions.data
+	} else if existingLock != nil {
+		newLockData = existingLock.data
+	}
+
+	if newLockData == nil {
+		// If there is no existing data, we write the input data to the lock.
+		newLockData = getLockOptions.data
+	}
+
+	mergedAdditionalAttributes := make(map[string]*dynamodb.AttributeValue)
+	for k, v := range existingLock.AdditionalAttributes() {
+		mergedAdditionalAttributes[k] = v
+	}
+	for k, v := range getLockOptions.additionalAttributes {
+		mergedAdditionalAttributes[k] = v
+	}
+	getLockOptions.additionalAttributes = mergedAdditionalAttributes
+
+	item := make(map[string]*dynamodb.AttributeValue)
+	for k, v := range getLockOptions.additionalAttributes {
+		item[k] = v
+	}
+	for k, v := range c.itemKeys(getLockOptions.partitionKeyName) {
+		item[k] = v
+	}
+	item[attrOwnerName] = &dynamodb.AttributeValue{S: aws.String(c.ownerName)}
+	item[attrLeaseDuration] = &dynamodb.AttributeValue{S: aws.String(c.leaseDuration.String())}
+
+	recordVersionNumber := c.generateRecordVersionNumber()
+	item[attrRecordVersionNumber] = &dynamodb.AttributeValue{S: aws.String(recordVersionNumber)}
+
+	if newLockData != nil {
+		item[attrData] = &dynamodb.AttributeValue{B: newLockData}
+	}
+
+	item[attrFencingToken] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(fencingToken, 10))}
+	item[attrLastUpdated] = lastUpdatedAttributeValue(time.Now())
+	if c.expiryAttribute != "" {
+		item[c.expiryAttribute] = c.expiryAttributeValue(time.Now())
+	}
+	return item, newLockData, recordVersionNumber
+}
+
 var pkExistsAndRvnIsTheSameCondition = fmt.Sprintf(
 	"attribute_exists(%s) AND %s = %s",
 	pkPathExpressionVariable, rvnPathExpressionVariable, rvnValueExpressionVariable)
 
 func (c *Client) upsertAndMonitorExpiredLock(
+	ctx context.Context,
 	additionalAttributes map[string]*dynamodb.AttributeValue,
 	key string,
 	deleteLockOnRelease bool,
@@ -475,21 +708,12 @@ func (c *Client) upsertAndMonitorExpiredLock(
 	newLockData []byte,
 	item map[string]*dynamodb.AttributeValue,
 	recordVersionNumber string,
+	fencingCounter *fencingCounter,
+	fencingToken int64,
 	sessionMonitor *sessionMonitor,
 ) (*Lock, error) {
-	var conditionalExpression string
-	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
-		rvnValueExpressionVariable: {S: aws.String(existingLock.recordVersionNumber)},
-	}
-
-	expressionAttributeNames := map[string]*string{
-		pkPathExpressionVariable:  aws.String(c.partitionKeyName),
-		rvnPathExpressionVariable: aws.String(attrRecordVersionNumber),
-	}
-
-	conditionalExpression = pkExistsAndRvnIsTheSameCondition
-
-	putItemRequest := &dynamodb.PutItemInput{
+	conditionalExpression, expressionAttributeNames, expressionAttributeValues := c.expiredLockCondition(existingLock)
+	putItemRequest := &dynamodb.Put{
 		Item:                      item,
 		TableName:                 aws.String(c.tableName),
 		ConditionExpression:       aws.String(conditionalExpression),
@@ -500,33 +724,43 @@ func (c *Client) upsertAndMonitorExpiredLock(
 	c.logger.Println("Acquiring an existing lock whose revisionVersionNumber did not change for ",
 		c.partitionKeyName, " partitionKeyName=", key)
 	return c.putLockItemAndStartSessionMonitor(
-		additionalAttributes, key, deleteLockOnRelease, newLockData,
-		recordVersionNumber, sessionMonitor, putItemRequest)
+		ctx, additionalAttributes, key, deleteLockOnRelease, newLockData,
+		recordVersionNumber, fencingCounter, fencingToken, sessionMonitor, putItemRequest)
+}
+
+// expiredLockCondition is the condition to take over existingLock once it
+// expired: no one must have refreshed it in the meantime.
+func (c *Client) expiredLockCondition(existingLock *Lock) (string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		rvnValueExpressionVariable: {S: aws.String(existingLock.recordVersionNumber)},
+	}
+
+	expressionAttributeNames := map[string]*string{
+		pkPathExpressionVariable:  aws.String(c.partitionKeyName),
+		rvnPathExpressionVariable: aws.String(attrRecordVersionNumber),
+	}
+
+	return pkExistsAndRvnIsTheSameCondition, expressionAttributeNames, expressionAttributeValues
 }
 
 func (c *Client) upsertAndMonitorNewOrReleasedLock(
+	ctx context.Context,
 	additionalAttributes map[string]*dynamodb.AttributeValue,
 	key string,
 	deleteLockOnRelease bool,
+	existingLock *Lock,
 	newLockData []byte,
 	item map[string]*dynamodb.AttributeValue,
 	recordVersionNumber string,
+	fencingCounter *fencingCounter,
+	fencingToken int64,
 	sessionMonitor *sessionMonitor,
 ) (*Lock, error) {
-
-	expressionAttributeNames := map[string]*string{
-		pkPathExpressionVariable:         aws.String(c.partitionKeyName),
-		isReleasedPathExpressionVariable: aws.String(attrIsReleased),
-	}
-
-	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
-		isReleasedValueExpressionVariable: isReleasedAttributeValue,
-	}
-
-	req := &dynamodb.PutItemInput{
+	conditionalExpression, expressionAttributeNames, expressionAttributeValues := c.newOrReleasedLockCondition(existingLock)
+	req := &dynamodb.Put{
 		Item:                      item,
 		TableName:                 aws.String(c.tableName),
-		ConditionExpression:       aws.String(acquireLockThatDoesntExistOrIsReleasedCondition),
+		ConditionExpression:       aws.String(conditionalExpression),
 		ExpressionAttributeNames:  expressionAttributeNames,
 		ExpressionAttributeValues: expressionAttributeValues,
 	}
@@ -536,24 +770,61 @@ func (c *Client) upsertAndMonitorNewOrReleasedLock(
 	// expire sooner than it actually will, so they start counting towards
 	// its expiration before the Put succeeds
 	c.logger.Println("Acquiring a new lock or an existing yet released lock on ", c.partitionKeyName, "=", key)
-	return c.putLockItemAndStartSessionMonitor(additionalAttributes, key,
+	return c.putLockItemAndStartSessionMonitor(ctx, additionalAttributes, key,
 		deleteLockOnRelease, newLockData,
-		recordVersionNumber, sessionMonitor, req)
+		recordVersionNumber, fencingCounter, fencingToken, sessionMonitor, req)
+}
+
+// newOrReleasedLockCondition is the condition to acquire a lock whose item
+// does not exist or is released: no one must have acquired it since
+// existingLock was read.
+func (c *Client) newOrReleasedLockCondition(existingLock *Lock) (string, map[string]*string, map[string]*dynamodb.AttributeValue) {
+	expressionAttributeNames := map[string]*string{
+		pkPathExpressionVariable:           aws.String(c.partitionKeyName),
+		isReleasedPathExpressionVariable:   aws.String(attrIsReleased),
+		fencingTokenPathExpressionVariable: aws.String(attrFencingToken),
+	}
+
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		isReleasedValueExpressionVariable: isReleasedAttributeValue,
+	}
+
+	fencingTokenCondition := fencingTokenDoesntExistCondition
+	if existingLock != nil && existingLock.fencingToken > 0 {
+		fencingTokenCondition = fencingTokenIsTheSameCondition
+		expressionAttributeValues[fencingTokenValueExpressionVariable] = &dynamodb.AttributeValue{
+			N: aws.String(strconv.FormatInt(existingLock.fencingToken, 10)),
+		}
+	}
+	conditionalExpression := fmt.Sprintf("(%s) AND %s",
+		acquireLockThatDoesntExistOrIsReleasedCondition, fencingTokenCondition)
+	return conditionalExpression, expressionAttributeNames, expressionAttributeValues
 }
 
 func (c *Client) putLockItemAndStartSessionMonitor(
+	ctx context.Context,
 	additionalAttributes map[string]*dynamodb.AttributeValue,
 	key string,
 	deleteLockOnRelease bool,
 	newLockData []byte,
 	recordVersionNumber string,
+	fencingCounter *fencingCounter,
+	fencingToken int64,
 	sessionMonitor *sessionMonitor,
-	putItemRequest *dynamodb.PutItemInput) (*Lock, error) {
+	putItemRequest *dynamodb.Put) (*Lock, error) {
 
 	lastUpdatedTime := time.Now()
 
-	_, err := c.dynamoDB.PutItem(putItemRequest)
-	if err != nil {
+	c.observer.AcquireAttempt(key)
+	_, err := c.dynamoDB.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Put: putItemRequest},
+			c.putFencingCounter(fencingCounter, fencingToken),
+		},
+	})
+	if transactionCanceledBy(err, cancellationReasonTransactionConflict) {
+		return nil, &LockNotGrantedError{msg: "cannot store lock item: concurrent acquisition in progress", cause: err}
+	} else if err != nil {
 		return nil, parseDynamoDBError(err, "cannot store lock item: lock already acquired by other client")
 	}
 
@@ -566,6 +837,7 @@ func (c *Client) putLockItemAndStartSessionMonitor(
 		leaseDuration:        c.leaseDuration,
 		lookupTime:           lastUpdatedTime,
 		recordVersionNumber:  recordVersionNumber,
+		fencingToken:         fencingToken,
 		additionalAttributes: additionalAttributes,
 		sessionMonitor:       sessionMonitor,
 	}
@@ -575,8 +847,8 @@ func (c *Client) putLockItemAndStartSessionMonitor(
 	return lockItem, nil
 }
 
-func (c *Client) getLockFromDynamoDB(opt getLockOptions) (*Lock, error) {
-	res, err := c.readFromDynamoDB(opt.partitionKeyName)
+func (c *Client) getLockFromDynamoDB(ctx context.Context, opt getLockOptions) (*Lock, error) {
+	res, err := c.readFromDynamoDB(ctx, opt.partitionKeyName)
 	if err != nil {
 		return nil, err
 	}
@@ -589,14 +861,11 @@ func (c *Client) getLockFromDynamoDB(opt getLockOptions) (*Lock, error) {
 	return c.createLockItem(opt, item)
 }
 
-func (c *Client) readFromDynamoDB(key string) (*dynamodb.GetItemOutput, error) {
-	dynamoDBKey := map[string]*dynamodb.AttributeValue{
-		c.partitionKeyName: {S: aws.String(key)},
-	}
-	return c.dynamoDB.GetItem(&dynamodb.GetItemInput{
+func (c *Client) readFromDynamoDB(ctx context.Context, key string) (*dynamodb.GetItemOutput, error) {
+	return c.dynamoDB.GetItemWithContext(ctx, &dynamodb.GetItemInput{
 		ConsistentRead: aws.Bool(true),
 		TableName:      aws.String(c.tableName),
-		Key:            dynamoDBKey,
+		Key:            c.itemKeys(key),
 	})
 }
 
@@ -619,6 +888,32 @@ func (c *Client) createLockItem(opt getLockOptions, item map[string]*dynamodb.At
 	_, isReleased := item[attrIsReleased]
 	delete(item, attrIsReleased)
 	delete(item, c.partitionKeyName)
+	if c.sortKeyName != "" {
+		delete(item, c.sortKeyName)
+	}
+	if c.expiryAttribute != "" {
+		delete(item, c.expiryAttribute)
+	}
+
+	var lastUpdated time.Time
+	if r, ok := item[attrLastUpdated]; ok {
+		var err error
+		lastUpdated, err = time.Parse(time.RFC3339Nano, aws.StringValue(r.S))
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse last updated time: %s", err)
+		}
+		delete(item, attrLastUpdated)
+	}
+
+	var fencingToken int64
+	if r, ok := item[attrFencingToken]; ok {
+		var err error
+		fencingToken, err = strconv.ParseInt(aws.StringValue(r.N), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse fencing token: %s", err)
+		}
+		delete(item, attrFencingToken)
+	}
 
 	// The person retrieving the lock in DynamoDB should err on the side of
 	// not expiring the lock, so they don't start counting until after the
@@ -644,6 +939,8 @@ func (c *Client) createLockItem(opt getLockOptions, item map[string]*dynamodb.At
 		lookupTime:           lookupTime,
 		recordVersionNumber:  aws.StringValue(recordVersionNumber.S),
 		isReleased:           isReleased,
+		fencingToken:         fencingToken,
+		lastUpdated:          lastUpdated,
 		additionalAttributes: item,
 	}
 	return lockItem, nil
@@ -666,30 +963,18 @@ func randString(n int) string {
 	return string(b)
 }
 
-func (c *Client) heartbeat(ctx context.Context) {
-	c.logger.Println("starting heartbeats")
-	tick := time.NewTicker(c.heartbeatPeriod)
-	defer tick.Stop()
-	for range tick.C {
-		c.locks.Range(func(_ interface{}, value interface{}) bool {
-			lockItem := value.(*Lock)
-			if err := c.SendHeartbeat(lockItem); err != nil {
-				c.logger.Println("error sending heartbeat to", lockItem.partitionKey, ":", err)
-			}
-			return true
-		})
-		if ctx.Err() != nil {
-			c.logger.Println("client closed, stopping heartbeat")
-			return
-		}
-	}
-}
-
 // CreateTable prepares a DynamoDB table with the right schema for it to be used
 // by this locking library. The table should be set up in advance, because it
 // takes a few minutes for DynamoDB to provision a new instance. Also, if the
 // table already exists, it will return an error.
 func (c *Client) CreateTable(tableName string, opts ...CreateTableOption) (*dynamodb.CreateTableOutput, error) {
+	return c.CreateTableWithContext(context.Background(), tableName, opts...)
+}
+
+// CreateTableWithContext prepares a DynamoDB table with the right schema for it
+// to be used by this locking library. The given context is passed down to the
+// underlying dynamoDB call.
+func (c *Client) CreateTableWithContext(ctx context.Context, tableName string, opts ...CreateTableOption) (*dynamodb.CreateTableOutput, error) {
 	if c.isClosed() {
 		return nil, ErrClientClosed
 	}
@@ -701,7 +986,7 @@ func (c *Client) CreateTable(tableName string, opts ...CreateTableOption) (*dyna
 	for _, opt := range opts {
 		opt(createTableOptions)
 	}
-	return c.createTable(createTableOptions)
+	return c.createTable(ctx, createTableOptions)
 }
 
 // CreateTableOption is an options type for the CreateTable method in the lock
@@ -718,6 +1003,23 @@ func WithCustomPartitionKeyName(s string) CreateTableOption {
 	}
 }
 
+// WithCustomSortKeyName adds to the table a sort key with the given name, so it
+// can be shared by clients using different sort key values (see WithSortKey).
+func WithCustomSortKeyName(s string) CreateTableOption {
+	return func(opt *createDynamoDBTableOptions) {
+		opt.sortKeyName = s
+	}
+}
+
+// WithTimeToLive enables DynamoDB time to live on the given attribute of the
+// table, so DynamoDB deletes the items whose time in that attribute has
+// passed. Use it along with WithExpiryAttribute in the lock client.
+func WithTimeToLive(attributeName string) CreateTableOption {
+	return func(opt *createDynamoDBTableOptions) {
+		opt.timeToLiveAttributeName = attributeName
+	}
+}
+
 // WithTags changes the tags of the table. If not specified, the table will have empty tags.
 func WithTags(tags []*dynamodb.Tag) CreateTableOption {
 	return func(opt *createDynamoDBTableOptions) {
@@ -734,7 +1036,7 @@ func WithProvisionedThroughput(provisionedThroughput *dynamodb.ProvisionedThroug
 	}
 }
 
-func (c *Client) createTable(opt *createDynamoDBTableOptions) (*dynamodb.CreateTableOutput, error) {
+func (c *Client) createTable(ctx context.Context, opt *createDynamoDBTableOptions) (*dynamodb.CreateTableOutput, error) {
 	keySchema := []*dynamodb.KeySchemaElement{
 		{
 			AttributeName: aws.String(opt.partitionKeyName),
@@ -749,6 +1051,17 @@ func (c *Client) createTable(opt *createDynamoDBTableOptions) (*dynamodb.CreateT
 		},
 	}
 
+	if opt.sortKeyName != "" {
+		keySchema = append(keySchema, &dynamodb.KeySchemaElement{
+			AttributeName: aws.String(opt.sortKeyName),
+			KeyType:       aws.String(dynamodb.KeyTypeRange),
+		})
+		attributeDefinitions = append(attributeDefinitions, &dynamodb.AttributeDefinition{
+			AttributeName: aws.String(opt.sortKeyName),
+			AttributeType: aws.String("S"),
+		})
+	}
+
 	createTableInput := &dynamodb.CreateTableInput{
 		TableName:            aws.String(opt.tableName),
 		KeySchema:            keySchema,
@@ -764,7 +1077,41 @@ func (c *Client) createTable(opt *createDynamoDBTableOptions) (*dynamodb.CreateT
 		createTableInput.Tags = opt.tags
 	}
 
-	return c.dynamoDB.CreateTable(createTableInput)
+	out, err := c.dynamoDB.CreateTableWithContext(ctx, createTableInput)
+	if err != nil || opt.timeToLiveAttributeName == "" {
+		return out, err
+	}
+	return out, c.enableTimeToLive(ctx, opt.tableName, opt.timeToLiveAttributeName)
+}
+
+// enableTimeToLive waits for the new table to become active, as DynamoDB
+// rejects changes to tables being created, and then enables time to live on
+// the given attribute.
+func (c *Client) enableTimeToLive(ctx context.Context, tableName, attributeName string) error {
+	for {
+		res, err := c.dynamoDB.DescribeTableWithContext(ctx, &dynamodb.DescribeTableInput{
+			TableName: aws.String(tableName),
+		})
+		if err != nil {
+			return err
+		}
+		if aws.StringValue(res.Table.TableStatus) == dynamodb.TableStatusActive {
+			break
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(defaultBuffer):
+		}
+	}
+	_, err := c.dynamoDB.UpdateTimeToLiveWithContext(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: aws.String(tableName),
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: aws.String(attributeName),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	return err
 }
 
 // ReleaseLock releases the given lock if the current user still has it,
@@ -772,10 +1119,18 @@ func (c *Client) createTable(opt *createDynamoDBTableOptions) (*dynamodb.CreateT
 // else already stole the lock or a problem happened. Deletes the lock item if
 // it is released and deleteLockItemOnClose is set.
 func (c *Client) ReleaseLock(lockItem *Lock, opts ...ReleaseLockOption) (bool, error) {
+	return c.ReleaseLockWithContext(context.Background(), lockItem, opts...)
+}
+
+// ReleaseLockWithContext releases the given lock if the current user still has
+// it, returning true if the lock was successfully released, and false if
+// someone else already stole the lock or a problem happened. The given context
+// is passed down to the underlying dynamoDB call.
+func (c *Client) ReleaseLockWithContext(ctx context.Context, lockItem *Lock, opts ...ReleaseLockOption) (bool, error) {
 	if c.isClosed() {
 		return false, ErrClientClosed
 	}
-	err := c.releaseLock(lockItem, opts...)
+	err := c.releaseLock(ctx, lockItem, opts...)
 	return err == nil, err
 }
 
@@ -802,7 +1157,7 @@ func WithDataAfterRelease(data []byte) ReleaseLockOption {
 // during the act of releasing a lock.
 type ReleaseLockOption func(*releaseLockOptions)
 
-func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
+func (c *Client) releaseLock(ctx context.Context, lockItem *Lock, opts ...ReleaseLockOption) (err error) {
 	options := &releaseLockOptions{
 		lockItem: lockItem,
 	}
@@ -822,11 +1177,15 @@ func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
 	if lockItem.ownerName != c.ownerName {
 		return ErrOwnerMismatched
 	}
+	defer func() {
+		c.observer.Release(lockItem.partitionKey, err)
+	}()
 
 	lockItem.semaphore.Lock()
 	defer lockItem.semaphore.Unlock()
 
 	lockItem.isReleased = true
+	lockItem.stopHeartbeat()
 	c.locks.Delete(lockItem.uniqueIdentifier())
 
 	var conditionalExpression string
@@ -851,7 +1210,7 @@ func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
 			ExpressionAttributeNames:  expressionAttributeNames,
 			ExpressionAttributeValues: expressionAttributeValues,
 		}
-		_, err := c.dynamoDB.DeleteItem(deleteItemRequest)
+		_, err := c.dynamoDB.DeleteItemWithContext(ctx, deleteItemRequest)
 		if err != nil {
 			return err
 		}
@@ -859,6 +1218,8 @@ func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
 		var updateExpression string
 		expressionAttributeNames[isReleasedPathExpressionVariable] = aws.String(attrIsReleased)
 		expressionAttributeValues[isReleasedValueExpressionVariable] = isReleasedAttributeValue
+		expressionAttributeNames[lastUpdatedPathExpressionVariable] = aws.String(attrLastUpdated)
+		expressionAttributeValues[lastUpdatedValueExpressionVariable] = lastUpdatedAttributeValue(time.Now())
 
 		if len(data) > 0 {
 			updateExpression = updateIsReleasedAndData
@@ -877,7 +1238,7 @@ func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
 			ExpressionAttributeValues: expressionAttributeValues,
 		}
 
-		_, err := c.dynamoDB.UpdateItem(updateItemRequest)
+		_, err := c.dynamoDB.UpdateItemWithContext(ctx, updateItemRequest)
 		if err != nil {
 			return err
 		}
@@ -889,17 +1250,32 @@ func (c *Client) releaseLock(lockItem *Lock, opts ...ReleaseLockOption) error {
 func (c *Client) releaseAllLocks() error {
 	var err error
 	c.locks.Range(func(key interface{}, value interface{}) bool {
-		err = c.releaseLock(value.(*Lock))
+		err = c.releaseLock(context.Background(), value.(*Lock))
+		return err == nil
+	})
+	if err != nil {
+		return err
+	}
+	c.leases.Range(func(key interface{}, value interface{}) bool {
+		err = c.releaseLease(context.Background(), value.(*lease))
 		return err == nil
 	})
 	return err
 }
 
 func (c *Client) getItemKeys(lockItem *Lock) map[string]*dynamodb.AttributeValue {
-	key := map[string]*dynamodb.AttributeValue{
-		c.partitionKeyName: {S: aws.String(lockItem.partitionKey)},
+	return c.itemKeys(lockItem.partitionKey)
+}
+
+// itemKeys returns the primary key of the lock item of the given key.
+func (c *Client) itemKeys(key string) map[string]*dynamodb.AttributeValue {
+	keys := map[string]*dynamodb.AttributeValue{
+		c.partitionKeyName: {S: aws.String(key)},
+	}
+	if c.sortKeyName != "" {
+		keys[c.sortKeyName] = &dynamodb.AttributeValue{S: aws.String(c.sortKey)}
 	}
-	return key
+	return keys
 }
 
 // Get finds out who owns the given lock, but does not acquire the lock. It
@@ -910,9 +1286,18 @@ func (c *Client) getItemKeys(lockItem *Lock) map[string]*dynamodb.AttributeValue
 // should check lockItem.isExpired() to figure out if it currently has the
 // lock.)
 func (c *Client) Get(key string) (*Lock, error) {
+	return c.GetWithContext(context.Background(), key)
+}
+
+// GetWithContext finds out who owns the given lock, but does not acquire the
+// lock. The given context is passed down to the underlying dynamoDB call.
+func (c *Client) GetWithContext(ctx context.Context, key string) (*Lock, error) {
 	if c.isClosed() {
 		return nil, ErrClientClosed
 	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
 
 	getLockOption := getLockOptions{
 		partitionKeyName: key,
@@ -925,7 +1310,7 @@ func (c *Client) Get(key string) (*Lock, error) {
 		return v.(*Lock), nil
 	}
 
-	lockItem, err := c.getLockFromDynamoDB(getLockOption)
+	lockItem, err := c.getLockFromDynamoDB(ctx, getLockOption)
 	if err != nil {
 		return nil, err
 	}
@@ -953,13 +1338,16 @@ func (c *Client) isClosed() bool {
 func (c *Client) Close() error {
 	err := ErrClientClosed
 	c.closeOnce.Do(func() {
-		// Hold the write lock for the duration of the close operation
-		// to prevent new locks from being acquired.
+		// Hold the write lock while releasing the locks to prevent new
+		// locks from being acquired.
 		c.mu.Lock()
-		defer c.mu.Unlock()
 		err = c.releaseAllLocks()
 		c.stopHeartbeat()
 		c.closed = true
+		c.mu.Unlock()
+		// Heartbeats check whether the client is closed, so they are
+		// waited for without holding the client lock.
+		c.heartbeats.Wait()
 	})
 	return err
 }
@@ -999,6 +1387,7 @@ func (c *Client) lockSessionMonitorChecker(ctx context.Context,
 					return
 				}
 				if timeUntilDangerZone <= 0 {
+					c.observer.DangerZoneEntered(lock.partitionKey)
 					go lock.sessionMonitor.callback()
 					return
 				}
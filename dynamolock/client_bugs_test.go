@@ -28,12 +28,8 @@ import (
 )
 
 func TestIssue56(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	lockClient, err := dynamolock.New(svc,
 		"locksIssue56",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -17,6 +17,8 @@ limitations under the License.
 package dynamolock
 
 import (
+	"context"
+	"fmt"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
@@ -54,6 +56,12 @@ func ReplaceHeartbeatData(data []byte) SendHeartbeatOption {
 // and sending heartbeats. However, if WithHeartbeatPeriod = 0, then this method
 // must be called to instruct DynamoDB that the lock should not be expired.
 func (c *Client) SendHeartbeat(lockItem *Lock, opts ...SendHeartbeatOption) error {
+	return c.SendHeartbeatWithContext(context.Background(), lockItem, opts...)
+}
+
+// SendHeartbeatWithContext indicates that the given lock is still being worked
+// on. The given context is passed down to the underlying dynamoDB call.
+func (c *Client) SendHeartbeatWithContext(ctx context.Context, lockItem *Lock, opts ...SendHeartbeatOption) error {
 	if c.isClosed() {
 		return ErrClientClosed
 	}
@@ -63,10 +71,12 @@ func (c *Client) SendHeartbeat(lockItem *Lock, opts ...SendHeartbeatOption) erro
 	for _, opt := range opts {
 		opt(sho)
 	}
-	return c.sendHeartbeat(sho)
+	err := c.sendHeartbeat(ctx, sho)
+	c.observeHeartbeat(lockItem.partitionKey, err)
+	return err
 }
 
-func (c *Client) sendHeartbeat(options *sendHeartbeatOptions) error {
+func (c *Client) sendHeartbeat(ctx context.Context, options *sendHeartbeatOptions) error {
 	leaseDuration := c.leaseDuration
 
 	lockItem := options.lockItem
@@ -93,24 +103,25 @@ func (c *Client) sendHeartbeat(options *sendHeartbeatOptions) error {
 		leaseDurationPathValueExpressionVariable: aws.String(attrLeaseDuration),
 		rvnPathExpressionVariable:                aws.String(attrRecordVersionNumber),
 		ownerNamePathExpressionVariable:          aws.String(attrOwnerName),
+		lastUpdatedPathExpressionVariable:        aws.String(attrLastUpdated),
 	}
 
 	conditionalExpression = pkExistsAndOwnerNameSameAndRvnSameCondition
 
 	rvn := c.generateRecordVersionNumber()
 
-	var updateExpression string
+	now := time.Now()
 	expressionAttributeValues[newRvnValueExpressionVariable] = &dynamodb.AttributeValue{S: aws.String(rvn)}
 	expressionAttributeValues[leaseDurationValueExpressionVariable] = &dynamodb.AttributeValue{S: aws.String(leaseDuration.String())}
+	expressionAttributeValues[lastUpdatedValueExpressionVariable] = lastUpdatedAttributeValue(now)
+	updateExpression := c.withExpiry(updateLeaseDurationAndRvn, now, expressionAttributeNames, expressionAttributeValues)
 	if options.deleteData {
 		expressionAttributeNames[dataPathExpressionVariable] = aws.String(attrData)
-		updateExpression = updateLeaseDurationAndRvnAndRemoveData
+		updateExpression += fmt.Sprintf(" REMOVE %s", dataPathExpressionVariable)
 	} else if len(options.data) > 0 {
 		expressionAttributeNames[dataPathExpressionVariable] = aws.String(attrData)
 		expressionAttributeValues[dataValueExpressionVariable] = &dynamodb.AttributeValue{B: options.data}
-		updateExpression = updateLeaseDurationAndRvnAndData
-	} else {
-		updateExpression = updateLeaseDurationAndRvn
+		updateExpression += fmt.Sprintf(", %s = %s", dataPathExpressionVariable, dataValueExpressionVariable)
 	}
 
 	updateItemInput := &dynamodb.UpdateItemInput{
@@ -124,7 +135,7 @@ func (c *Client) sendHeartbeat(options *sendHeartbeatOptions) error {
 
 	lastUpdateOfLock := time.Now()
 
-	_, err := c.dynamoDB.UpdateItem(updateItemInput)
+	_, err := c.dynamoDB.UpdateItemWithContext(ctx, updateItemInput)
 	if err != nil {
 		err := parseDynamoDBError(err, "already acquired lock, stopping heartbeats")
 		if isLockNotGrantedError(err) {
@@ -136,3 +147,100 @@ func (c *Client) sendHeartbeat(options *sendHeartbeatOptions) error {
 	lockItem.updateRVN(rvn, lastUpdateOfLock, leaseDuration)
 	return nil
 }
+
+// startHeartbeat spawns the goroutine that keeps the given lock alive until it
+// is released, lost or the client is closed.
+func (c *Client) startHeartbeat(lockItem *Lock, refreshPeriod time.Duration, errorHandler func(error)) {
+	if c.heartbeatPeriod <= 0 {
+		return
+	}
+	lockItem.semaphore.Lock()
+	defer lockItem.semaphore.Unlock()
+	if lockItem.isReleased {
+		return
+	}
+	ctx, cancel := context.WithCancel(c.heartbeatContext)
+	lockItem.refreshPeriod = refreshPeriod
+	lockItem.cancelHeartbeat = cancel
+	c.goHeartbeat(ctx, lockItem, errorHandler)
+}
+
+// goHeartbeat runs heartbeat in a goroutine that Close waits for.
+func (c *Client) goHeartbeat(ctx context.Context, target heartbeatTarget, errorHandler func(error)) {
+	c.heartbeats.Add(1)
+	go func() {
+		defer c.heartbeats.Done()
+		c.heartbeat(ctx, target, errorHandler)
+	}()
+}
+
+// heartbeatTarget is kept alive by the heartbeat goroutines: it is either a
+// Lock or a lease held in a shared lock item.
+type heartbeatTarget interface {
+	heartbeatName() string
+	timeUntilNextHeartbeat(heartbeatPeriod time.Duration) time.Duration
+	retryPeriod() time.Duration
+	isTracked() bool
+	sendHeartbeat(ctx context.Context) error
+}
+
+// heartbeat sends the heartbeats of a single lock for as long as the client
+// keeps track of it. Each heartbeat is scheduled one heartbeat period after the
+// last time the lock was refreshed, so manual calls to SendHeartbeat postpone
+// the automatic ones. Failed heartbeats are retried after the lock's refresh
+// period, unless the lock has been lost.
+func (c *Client) heartbeat(ctx context.Context, target heartbeatTarget, errorHandler func(error)) {
+	c.logger.Println("starting heartbeats for", target.heartbeatName())
+	defer c.logger.Println("stopped heartbeats for", target.heartbeatName())
+	var retry time.Duration
+	for {
+		wait := retry
+		if wait == 0 {
+			wait = target.timeUntilNextHeartbeat(c.heartbeatPeriod)
+		}
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if retry == 0 && target.timeUntilNextHeartbeat(c.heartbeatPeriod) > 0 {
+			continue
+		}
+		if !target.isTracked() {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case c.heartbeatSlots <- struct{}{}:
+		}
+		err := target.sendHeartbeat(ctx)
+		<-c.heartbeatSlots
+
+		if err == nil {
+			retry = 0
+			continue
+		} else if ctx.Err() != nil {
+			return
+		}
+		c.logger.Println("error sending heartbeat to", target.heartbeatName(), ":", err)
+		if errorHandler != nil {
+			errorHandler(err)
+		}
+		if isLockNotGrantedError(err) || err == ErrClientClosed {
+			return
+		}
+		retry = target.retryPeriod()
+		if retry <= 0 || retry > c.heartbeatPeriod {
+			retry = c.heartbeatPeriod
+		}
+	}
+}
+
+func (c *Client) isTracked(lockItem *Lock) bool {
+	v, ok := c.locks.Load(lockItem.uniqueIdentifier())
+	return ok && v.(*Lock) == lockItem
+}
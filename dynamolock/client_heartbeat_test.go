@@ -23,22 +23,21 @@ import (
 	"time"
 
 	"cirello.io/dynamolock"
+	"cirello.io/dynamolock/dynamolocktest"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"golang.org/x/xerrors"
 )
 
 func TestCancelationWithoutHearbeat(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
 	defer func() {
 		if r := recover(); r != nil {
 			t.Fatal("panic found when closing client without heartbeat")
 		}
 	}()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.DisableHeartbeat(),
@@ -50,12 +49,8 @@ func TestCancelationWithoutHearbeat(t *testing.T) {
 }
 
 func TestHeartbeatHandover(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -144,12 +139,8 @@ func TestHeartbeatHandover(t *testing.T) {
 }
 
 func TestHeartbeatDataOps(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	newClient := func() (*dynamolock.Client, error) {
 		return dynamolock.New(svc,
 			"locks",
@@ -265,3 +256,139 @@ func TestHeartbeatDataOps(t *testing.T) {
 		}
 	})
 }
+
+func TestHeartbeatErrorHandler(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	heartbeatPeriod := 500 * time.Millisecond
+	c, err := dynamolock.New(svc,
+		"locks",
+		dynamolock.WithLeaseDuration(3*time.Second),
+		dynamolock.WithHeartbeatPeriod(heartbeatPeriod),
+		dynamolock.WithOwnerName("TestHeartbeatErrorHandler#1"),
+		dynamolock.WithPartitionKeyName("key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	t.Log("ensuring table exists")
+	c.CreateTable("locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+	)
+
+	const lockName = "heartbeat-error-handler"
+	heartbeatErrs := make(chan error, 1)
+	_, err = c.AcquireLock(lockName, dynamolock.WithHeartbeatErrorHandler(func(err error) {
+		heartbeatErrs <- err
+	}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String(lockName)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case err := <-heartbeatErrs:
+		var errNotGranted *dynamolock.LockNotGrantedError
+		if !xerrors.As(err, &errNotGranted) {
+			t.Fatal("unexpected heartbeat error:", err)
+		}
+	case <-time.After(4 * heartbeatPeriod):
+		t.Fatal("heartbeat error handler not called")
+	}
+}
+
+type slowHeartbeatDynamoDB struct {
+	*dynamolocktest.DynamoDB
+	delay time.Duration
+
+	mu          sync.Mutex
+	inFlight    int
+	maxInFlight int
+}
+
+func (s *slowHeartbeatDynamoDB) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, opts ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	s.mu.Lock()
+	s.inFlight++
+	if s.inFlight > s.maxInFlight {
+		s.maxInFlight = s.inFlight
+	}
+	s.mu.Unlock()
+	defer func() {
+		s.mu.Lock()
+		s.inFlight--
+		s.mu.Unlock()
+	}()
+	time.Sleep(s.delay)
+	return s.DynamoDB.UpdateItemWithContext(ctx, input, opts...)
+}
+
+func TestHeartbeatConcurrency(t *testing.T) {
+	t.Parallel()
+	heartbeatPeriod := 500 * time.Millisecond
+	svc := &slowHeartbeatDynamoDB{
+		DynamoDB: dynamolocktest.New(),
+		delay:    heartbeatPeriod / 2,
+	}
+	const maxConcurrentHeartbeats = 2
+	c, err := dynamolock.New(svc,
+		"locks",
+		dynamolock.WithLeaseDuration(3*time.Second),
+		dynamolock.WithHeartbeatPeriod(heartbeatPeriod),
+		dynamolock.WithMaxConcurrentHeartbeats(maxConcurrentHeartbeats),
+		dynamolock.WithOwnerName("TestHeartbeatConcurrency#1"),
+		dynamolock.WithPartitionKeyName("key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	if _, err := c.CreateTable("locks", dynamolock.WithCustomPartitionKeyName("key")); err != nil {
+		t.Fatal(err)
+	}
+
+	var locks []*dynamolock.Lock
+	for _, name := range []string{"alpha", "beta", "gamma", "delta"} {
+		l, err := c.AcquireLock(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		locks = append(locks, l)
+	}
+	time.Sleep(4 * heartbeatPeriod)
+	for _, l := range locks {
+		if l.IsExpired() {
+			t.Error("slow heartbeats should not expire locks:", l)
+		}
+	}
+	svc.mu.Lock()
+	defer svc.mu.Unlock()
+	if svc.maxInFlight > maxConcurrentHeartbeats {
+		t.Fatal("too many concurrent heartbeats:", svc.maxInFlight)
+	} else if svc.maxInFlight < maxConcurrentHeartbeats {
+		t.Fatal("heartbeats were not sent concurrently:", svc.maxInFlight)
+	}
+}
+
+func TestInvalidMaxConcurrentHeartbeats(t *testing.T) {
+	t.Parallel()
+	_, err := dynamolock.New(dynamolocktest.New(),
+		"locks",
+		dynamolock.WithMaxConcurrentHeartbeats(0),
+	)
+	if err == nil {
+		t.Fatal("expected error not found")
+	}
+}
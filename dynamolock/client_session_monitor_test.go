@@ -27,12 +27,8 @@ import (
 )
 
 func TestSessionMonitor(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -84,12 +80,8 @@ func TestSessionMonitor(t *testing.T) {
 }
 
 func TestSessionMonitorRemoveBeforeExpiration(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks-monitor",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -140,12 +132,8 @@ func TestSessionMonitorRemoveBeforeExpiration(t *testing.T) {
 }
 
 func TestSessionMonitorFullCycle(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -18,6 +18,7 @@ package dynamolock_test
 
 import (
 	"bytes"
+	"context"
 	"errors"
 	"fmt"
 	"log"
@@ -28,17 +29,28 @@ import (
 	"time"
 
 	"cirello.io/dynamolock"
+	"cirello.io/dynamolock/dynamolocktest"
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"golang.org/x/xerrors"
 )
 
-func isDynamoLockAvailable(t *testing.T) {
-	_, err := net.Dial("tcp", "localhost:8000")
+// newDynamoDB connects to DynamoDB Local when it is available, falling back to
+// the in-memory implementation otherwise.
+func newDynamoDB(t *testing.T) dynamodbiface.DynamoDBAPI {
+	conn, err := net.Dial("tcp", "localhost:8000")
 	if err != nil {
-		t.Skipf("cannot dial to dynamoDB: %v", err)
+		t.Log("cannot dial to dynamoDB, using dynamolocktest:", err)
+		return dynamolocktest.New()
 	}
+	conn.Close()
+	return dynamodb.New(mustAWSNewSession(t), &aws.Config{
+		Endpoint: aws.String("http://localhost:8000/"),
+		Region:   aws.String("us-west-2"),
+	})
 }
 
 func mustAWSNewSession(t *testing.T) *session.Session {
@@ -50,12 +62,8 @@ func mustAWSNewSession(t *testing.T) *session.Session {
 }
 
 func TestClientBasicFlow(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -149,14 +157,10 @@ func TestClientBasicFlow(t *testing.T) {
 }
 
 func TestReadLockContent(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
 
 	t.Run("standard load", func(t *testing.T) {
-		svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-			Endpoint: aws.String("http://localhost:8000/"),
-			Region:   aws.String("us-west-2"),
-		})
+		svc := newDynamoDB(t)
 		c, err := dynamolock.New(svc,
 			"locks",
 			dynamolock.WithLeaseDuration(3*time.Second),
@@ -214,10 +218,7 @@ func TestReadLockContent(t *testing.T) {
 		}
 	})
 	t.Run("cached load", func(t *testing.T) {
-		svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-			Endpoint: aws.String("http://localhost:8000/"),
-			Region:   aws.String("us-west-2"),
-		})
+		svc := newDynamoDB(t)
 		c, err := dynamolock.New(svc,
 			"locks",
 			dynamolock.WithLeaseDuration(3*time.Second),
@@ -258,12 +259,8 @@ func TestReadLockContent(t *testing.T) {
 }
 
 func TestReadLockContentAfterRelease(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -323,12 +320,8 @@ func TestReadLockContentAfterRelease(t *testing.T) {
 }
 
 func TestReadLockContentAfterDeleteOnRelease(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -389,12 +382,8 @@ func TestReadLockContentAfterDeleteOnRelease(t *testing.T) {
 }
 
 func TestInvalidLeaseHeartbeatRation(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	_, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(1*time.Second),
@@ -406,12 +395,8 @@ func TestInvalidLeaseHeartbeatRation(t *testing.T) {
 }
 
 func TestFailIfLocked(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -444,12 +429,8 @@ func TestFailIfLocked(t *testing.T) {
 }
 
 func TestClientWithAdditionalAttributes(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -527,12 +508,8 @@ func TestClientWithAdditionalAttributes(t *testing.T) {
 }
 
 func TestDeleteLockOnRelease(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -581,12 +558,8 @@ func TestDeleteLockOnRelease(t *testing.T) {
 }
 
 func TestCustomRefreshPeriod(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	var buf bytes.Buffer
 	logger := log.New(&buf, "", 0)
 	c, err := dynamolock.New(svc,
@@ -623,12 +596,8 @@ func TestCustomRefreshPeriod(t *testing.T) {
 }
 
 func TestCustomAdditionalTimeToWaitForLock(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -672,12 +641,8 @@ func TestCustomAdditionalTimeToWaitForLock(t *testing.T) {
 }
 
 func TestClientClose(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -745,12 +710,8 @@ func TestClientClose(t *testing.T) {
 }
 
 func TestInvalidReleases(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -812,12 +773,8 @@ func TestInvalidReleases(t *testing.T) {
 }
 
 func TestClientWithDataAfterRelease(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	c, err := dynamolock.New(svc,
 		"locks",
 		dynamolock.WithLeaseDuration(3*time.Second),
@@ -871,12 +828,8 @@ func (t *testLogger) Println(v ...interface{}) {
 }
 
 func TestHeartbeatLoss(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 	heartbeatPeriod := 5 * time.Second
 	c, err := dynamolock.New(svc,
 		"locks",
@@ -928,12 +881,8 @@ func TestHeartbeatLoss(t *testing.T) {
 }
 
 func TestHeartbeatError(t *testing.T) {
-	isDynamoLockAvailable(t)
 	t.Parallel()
-	svc := dynamodb.New(mustAWSNewSession(t), &aws.Config{
-		Endpoint: aws.String("http://localhost:8000/"),
-		Region:   aws.String("us-west-2"),
-	})
+	svc := newDynamoDB(t)
 
 	var buf lockStepBuffer
 	fatal := func(a ...interface{}) {
@@ -983,7 +932,9 @@ func TestHeartbeatError(t *testing.T) {
 		fatal(fmt.Sprintf("could not delete table: %v", err))
 	}
 
-	time.Sleep(heartbeatPeriod)
+	// Heartbeats are due a period after the acquisition, so stay clear of
+	// the moment the next one is sent.
+	time.Sleep(heartbeatPeriod + heartbeatPeriod/2)
 
 	c.Close()
 
@@ -994,6 +945,122 @@ func TestHeartbeatError(t *testing.T) {
 	}
 }
 
+func TestDo(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	heartbeatPeriod := 500 * time.Millisecond
+	c, err := dynamolock.New(svc,
+		"locks",
+		dynamolock.WithLeaseDuration(3*time.Second),
+		dynamolock.WithHeartbeatPeriod(heartbeatPeriod),
+		dynamolock.WithOwnerName("TestDo#1"),
+		dynamolock.WithLogger(&testLogger{t: t}),
+		dynamolock.WithPartitionKeyName("key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	t.Log("ensuring table exists")
+	c.CreateTable("locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+	)
+
+	t.Run("release on return", func(t *testing.T) {
+		const lockName = "do-release"
+		err := c.Do(context.Background(), lockName, func(ctx context.Context, l *dynamolock.Lock) error {
+			if l.IsExpired() {
+				t.Error("lock should be held while running f")
+			}
+			time.Sleep(2 * heartbeatPeriod)
+			return ctx.Err()
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		l, err := c.AcquireLock(lockName, dynamolock.FailIfLocked())
+		if err != nil {
+			t.Fatal("lock should have been released after Do:", err)
+		}
+		l.Close()
+	})
+
+	t.Run("release error", func(t *testing.T) {
+		const lockName = "do-release-error"
+		err := c.Do(context.Background(), lockName, func(ctx context.Context, l *dynamolock.Lock) error {
+			_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+				TableName: aws.String("locks"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"key": {S: aws.String(lockName)},
+				},
+			})
+			return err
+		})
+		if err == nil {
+			t.Fatal("the release error should be returned when f succeeds")
+		}
+	})
+
+	t.Run("cancel on heartbeat loss", func(t *testing.T) {
+		const lockName = "do-heartbeat-loss"
+		errLost := errors.New("lost lock")
+		err := c.Do(context.Background(), lockName, func(ctx context.Context, l *dynamolock.Lock) error {
+			_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+				TableName: aws.String("locks"),
+				Key: map[string]*dynamodb.AttributeValue{
+					"key": {S: aws.String(lockName)},
+				},
+			})
+			if err != nil {
+				return err
+			}
+			select {
+			case <-ctx.Done():
+				return errLost
+			case <-time.After(10 * heartbeatPeriod):
+				return nil
+			}
+		})
+		if err != errLost {
+			t.Fatal("context passed to f should be canceled when the lock is lost:", err)
+		}
+	})
+
+	t.Run("cancel on session monitor", func(t *testing.T) {
+		const lockName = "do-session-monitor"
+		var (
+			mu                         sync.Mutex
+			sessionMonitorWasTriggered bool
+		)
+		err := c.Do(context.Background(), lockName, func(ctx context.Context, l *dynamolock.Lock) error {
+			select {
+			case <-ctx.Done():
+				return nil
+			case <-time.After(10 * heartbeatPeriod):
+				return errors.New("context not canceled")
+			}
+		}, dynamolock.WithSessionMonitor(0, func() {
+			mu.Lock()
+			sessionMonitorWasTriggered = true
+			mu.Unlock()
+		}))
+		if err != nil {
+			t.Fatal(err)
+		}
+		time.Sleep(heartbeatPeriod)
+		mu.Lock()
+		defer mu.Unlock()
+		if !sessionMonitorWasTriggered {
+			t.Fatal("user-provided session monitor callback was not called")
+		}
+	})
+}
+
 type lockStepBuffer struct {
 	mu  sync.Mutex
 	buf bytes.Buffer
@@ -1015,7 +1082,7 @@ type fakeDynamoDB struct {
 	dynamodbiface.DynamoDBAPI
 }
 
-func (f *fakeDynamoDB) GetItem(*dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+func (f *fakeDynamoDB) GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error) {
 	return nil, errors.New("service is offline")
 }
 
@@ -1042,3 +1109,246 @@ func TestBadDynamoDB(t *testing.T) {
 		}
 	})
 }
+
+type lockedDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+}
+
+func (f *lockedDynamoDB) GetItemWithContext(aws.Context, *dynamodb.GetItemInput, ...request.Option) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{
+		Item: map[string]*dynamodb.AttributeValue{
+			"key":                 {S: aws.String("locked")},
+			"ownerName":           {S: aws.String("someone-else")},
+			"leaseDuration":       {S: aws.String("1h")},
+			"recordVersionNumber": {S: aws.String("rvn")},
+		},
+	}, nil
+}
+
+func TestAcquireLockWithContext(t *testing.T) {
+	t.Parallel()
+	c, err := dynamolock.New(&lockedDynamoDB{}, "locksCtx", dynamolock.DisableHeartbeat())
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 500*time.Millisecond)
+	defer cancel()
+	_, err = c.AcquireLockWithContext(ctx, "locked",
+		dynamolock.WithRefreshPeriod(100*time.Millisecond),
+	)
+	var errNotGranted *dynamolock.LockNotGrantedError
+	if !xerrors.As(err, &errNotGranted) {
+		t.Fatal("expected lock not granted error:", err)
+	}
+	if !xerrors.Is(err, context.DeadlineExceeded) {
+		t.Fatal("expected context deadline to be the cause:", err)
+	}
+}
+
+func TestFencingToken(t *testing.T) {
+	t.Parallel()
+	svc := &countingDynamoDB{DynamoDBAPI: newDynamoDB(t)}
+	newClient := func(owner string) *dynamolock.Client {
+		c, err := dynamolock.New(svc,
+			"locks",
+			dynamolock.WithLeaseDuration(1*time.Second),
+			dynamolock.DisableHeartbeat(),
+			dynamolock.WithOwnerName(owner),
+			dynamolock.WithPartitionKeyName("key"),
+		)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return c
+	}
+	c1, c2 := newClient("FencingToken#1"), newClient("FencingToken#2")
+	defer c1.Close()
+	defer c2.Close()
+
+	t.Log("ensuring table exists")
+	c1.CreateTable("locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+	)
+
+	const key = "fencingToken"
+	lockItem, err := c1.AcquireLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lockItem.FencingToken(); got != 1 {
+		t.Fatal("unexpected fencing token for new lock:", got)
+	}
+	if _, err := c1.ReleaseLock(lockItem); err != nil {
+		t.Fatal(err)
+	}
+
+	gets := svc.gets()
+	lockItem, err = c1.AcquireLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lockItem.FencingToken(); got != 2 {
+		t.Fatal("unexpected fencing token for released lock:", got)
+	}
+	if got := svc.gets() - gets; got != 1 {
+		t.Fatal("the counter item must not be read when the lock item carries the token, reads:", got)
+	}
+
+	t.Log("stealing expired lock")
+	stolen, err := c2.AcquireLock(key, dynamolock.WithRefreshPeriod(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := stolen.FencingToken(); got != 3 {
+		t.Fatal("unexpected fencing token for stolen lock:", got)
+	}
+	if stolen.FencingToken() <= lockItem.FencingToken() {
+		t.Fatal("stolen lock must have a greater fencing token than the stale one")
+	}
+
+	got, err := c2.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.FencingToken() != stolen.FencingToken() {
+		t.Fatal("Get returned an unexpected fencing token:", got.FencingToken())
+	}
+	if _, ok := got.AdditionalAttributes()["fencingToken"]; ok {
+		t.Fatal("fencing token must not be exposed as an additional attribute")
+	}
+
+	_, err = c1.AcquireLock("other", dynamolock.WithAdditionalAttributes(map[string]*dynamodb.AttributeValue{
+		"fencingToken": {N: aws.String("42")},
+	}))
+	if err == nil {
+		t.Fatal("fencing token must not be accepted as an additional attribute")
+	}
+
+	t.Log("deleting the lock item on release")
+	if _, err := c2.ReleaseLock(stolen, dynamolock.WithDeleteLock(true)); err != nil {
+		t.Fatal(err)
+	}
+	lockItem, err = c1.AcquireLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lockItem.FencingToken(); got != 4 {
+		t.Fatal("unexpected fencing token after the lock item was deleted:", got)
+	}
+
+	t.Log("removing the abandoned lock item, as time to live would")
+	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key:       map[string]*dynamodb.AttributeValue{"key": {S: aws.String(key)}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lockItem, err = c2.AcquireLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := lockItem.FencingToken(); got != 5 {
+		t.Fatal("unexpected fencing token after the lock item expired:", got)
+	}
+
+	if _, err := c1.AcquireLock("dynamolock.fencing#" + key); err != dynamolock.ErrReservedKey {
+		t.Fatal("expected ErrReservedKey:", err)
+	}
+}
+
+type countingDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	mu       sync.Mutex
+	getItems int
+}
+
+func (c *countingDynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, opts ...request.Option) (*dynamodb.GetItemOutput, error) {
+	c.mu.Lock()
+	c.getItems++
+	c.mu.Unlock()
+	return c.DynamoDBAPI.GetItemWithContext(ctx, input, opts...)
+}
+
+func (c *countingDynamoDB) gets() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.getItems
+}
+
+type racingDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	once sync.Once
+	race func()
+}
+
+func (r *racingDynamoDB) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, opts ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	r.once.Do(r.race)
+	return r.DynamoDBAPI.TransactWriteItemsWithContext(ctx, input, opts...)
+}
+
+func TestFencingTokenRace(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	other, err := dynamolock.New(svc,
+		"locks",
+		dynamolock.DisableHeartbeat(),
+		dynamolock.WithOwnerName("FencingTokenRace#2"),
+		dynamolock.WithPartitionKeyName("key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer other.Close()
+
+	t.Log("ensuring table exists")
+	other.CreateTable("locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+	)
+
+	const key = "fencingTokenRace"
+	var otherToken int64
+	racing := &racingDynamoDB{DynamoDBAPI: svc}
+	racing.race = func() {
+		// acquire and release the lock between the read and the write of
+		// the first client.
+		l, err := other.AcquireLock(key)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		otherToken = l.FencingToken()
+		if _, err := other.ReleaseLock(l); err != nil {
+			t.Error(err)
+		}
+	}
+	c, err := dynamolock.New(racing,
+		"locks",
+		dynamolock.DisableHeartbeat(),
+		dynamolock.WithOwnerName("FencingTokenRace#1"),
+		dynamolock.WithPartitionKeyName("key"),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+
+	lockItem, err := c.AcquireLock(key, dynamolock.WithRefreshPeriod(100*time.Millisecond))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if otherToken == 0 {
+		t.Fatal("racing acquisition did not happen")
+	}
+	if lockItem.FencingToken() <= otherToken {
+		t.Fatal("fencing token was reused:", lockItem.FencingToken(), otherToken)
+	}
+}
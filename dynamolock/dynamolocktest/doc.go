@@ -0,0 +1,37 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Package dynamolocktest provides an in-memory DynamoDB that can be plugged
+// into dynamolock.New, so code depending on dynamolock can be tested without
+// DynamoDB Local or any other external process.
+//
+// Only the operations and expressions that dynamolock relies on are
+// implemented. Conditional writes are evaluated atomically, so the semantics
+// of lock acquisition, heartbeats and releases are the same as the ones
+// observed against the real service.
+//
+// Basic usage:
+//
+//	svc := dynamolocktest.New()
+//	c, err := dynamolock.New(svc, "locks")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	defer c.Close()
+//	if _, err := c.CreateTable("locks"); err != nil {
+//		log.Fatal(err)
+//	}
+package dynamolocktest // import "cirello.io/dynamolock/dynamolocktest"
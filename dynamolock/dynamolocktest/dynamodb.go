@@ -0,0 +1,902 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolocktest
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+const errCodeValidationException = "ValidationException"
+
+// DynamoDB is an in-memory, goroutine-safe implementation of the subset of
+// dynamodbiface.DynamoDBAPI used by dynamolock. Calling any operation that is
+// not implemented panics.
+type DynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+
+	mu     sync.Mutex
+	tables map[string]*table
+}
+
+type table struct {
+	description *dynamodb.TableDescription
+	hashKey     string
+	rangeKey    string
+	keyTypes    map[string]string
+	items       map[string]item
+	timeToLive  *dynamodb.TimeToLiveDescription
+}
+
+// New creates an empty in-memory DynamoDB.
+func New() *DynamoDB {
+	return &DynamoDB{
+		tables: make(map[string]*table),
+	}
+}
+
+func validationError(format string, a ...interface{}) error {
+	return awserr.NewRequestFailure(
+		awserr.New(errCodeValidationException, fmt.Sprintf(format, a...), nil),
+		400, "")
+}
+
+func requestFailure(code, msg string) error {
+	return awserr.NewRequestFailure(awserr.New(code, msg, nil), 400, "")
+}
+
+func checkContext(ctx aws.Context) error {
+	if ctx == nil {
+		return nil
+	}
+	if err := ctx.Err(); err != nil {
+		return awserr.New(request.CanceledErrorCode, "request context canceled", err)
+	}
+	return nil
+}
+
+func (db *DynamoDB) table(name *string) (*table, error) {
+	t, ok := db.tables[aws.StringValue(name)]
+	if !ok {
+		return nil, requestFailure(dynamodb.ErrCodeResourceNotFoundException,
+			"Cannot do operations on a non-existent table")
+	}
+	return t, nil
+}
+
+// CreateTable creates a new table using the key schema of the given input.
+func (db *DynamoDB) CreateTable(input *dynamodb.CreateTableInput) (*dynamodb.CreateTableOutput, error) {
+	return db.CreateTableWithContext(context.Background(), input)
+}
+
+// CreateTableWithContext creates a new table using the key schema of the given
+// input.
+func (db *DynamoDB) CreateTableWithContext(ctx aws.Context, input *dynamodb.CreateTableInput, _ ...request.Option) (*dynamodb.CreateTableOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	name := aws.StringValue(input.TableName)
+	if _, ok := db.tables[name]; ok {
+		return nil, requestFailure(dynamodb.ErrCodeResourceInUseException, "Cannot create preexisting table")
+	}
+	t := &table{
+		keyTypes: make(map[string]string),
+		items:    make(map[string]item),
+	}
+	for _, ad := range input.AttributeDefinitions {
+		t.keyTypes[aws.StringValue(ad.AttributeName)] = aws.StringValue(ad.AttributeType)
+	}
+	for _, ks := range input.KeySchema {
+		attr := aws.StringValue(ks.AttributeName)
+		if _, ok := t.keyTypes[attr]; !ok {
+			return nil, validationError("One or more parameter values were invalid: Some index key attributes are not defined in AttributeDefinitions. Keys: [%s]", attr)
+		}
+		switch aws.StringValue(ks.KeyType) {
+		case dynamodb.KeyTypeHash:
+			t.hashKey = attr
+		case dynamodb.KeyTypeRange:
+			t.rangeKey = attr
+		}
+	}
+	if t.hashKey == "" {
+		return nil, validationError("One or more parameter values were invalid: Missing the key %s in the key schema", dynamodb.KeyTypeHash)
+	}
+	for k := range t.keyTypes {
+		if k != t.hashKey && k != t.rangeKey {
+			return nil, validationError("One or more parameter values were invalid: Number of attributes in KeySchema does not exactly match number of attributes defined in AttributeDefinitions")
+		}
+	}
+	t.description = &dynamodb.TableDescription{
+		AttributeDefinitions:  input.AttributeDefinitions,
+		CreationDateTime:      aws.Time(time.Now()),
+		KeySchema:             input.KeySchema,
+		ProvisionedThroughput: &dynamodb.ProvisionedThroughputDescription{},
+		TableName:             input.TableName,
+		TableStatus:           aws.String(dynamodb.TableStatusActive),
+	}
+	if input.BillingMode != nil {
+		t.description.BillingModeSummary = &dynamodb.BillingModeSummary{
+			BillingMode: input.BillingMode,
+		}
+	}
+	if pt := input.ProvisionedThroughput; pt != nil {
+		t.description.ProvisionedThroughput.ReadCapacityUnits = pt.ReadCapacityUnits
+		t.description.ProvisionedThroughput.WriteCapacityUnits = pt.WriteCapacityUnits
+	}
+	db.tables[name] = t
+	return &dynamodb.CreateTableOutput{TableDescription: t.describe()}, nil
+}
+
+func (t *table) describe() *dynamodb.TableDescription {
+	desc := *t.description
+	desc.ItemCount = aws.Int64(int64(len(t.items)))
+	return &desc
+}
+
+// DeleteTable drops the given table and all its items.
+func (db *DynamoDB) DeleteTable(input *dynamodb.DeleteTableInput) (*dynamodb.DeleteTableOutput, error) {
+	return db.DeleteTableWithContext(context.Background(), input)
+}
+
+// DeleteTableWithContext drops the given table and all its items.
+func (db *DynamoDB) DeleteTableWithContext(ctx aws.Context, input *dynamodb.DeleteTableInput, _ ...request.Option) (*dynamodb.DeleteTableOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	delete(db.tables, aws.StringValue(input.TableName))
+	desc := t.describe()
+	desc.TableStatus = aws.String(dynamodb.TableStatusDeleting)
+	return &dynamodb.DeleteTableOutput{TableDescription: desc}, nil
+}
+
+// DescribeTable returns the description of the given table.
+func (db *DynamoDB) DescribeTable(input *dynamodb.DescribeTableInput) (*dynamodb.DescribeTableOutput, error) {
+	return db.DescribeTableWithContext(context.Background(), input)
+}
+
+// DescribeTableWithContext returns the description of the given table.
+func (db *DynamoDB) DescribeTableWithContext(ctx aws.Context, input *dynamodb.DescribeTableInput, _ ...request.Option) (*dynamodb.DescribeTableOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.DescribeTableOutput{Table: t.describe()}, nil
+}
+
+// UpdateTimeToLive enables or disables time to live on the given table. Items
+// are never expired by this implementation; only the setting is recorded.
+func (db *DynamoDB) UpdateTimeToLive(input *dynamodb.UpdateTimeToLiveInput) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	return db.UpdateTimeToLiveWithContext(context.Background(), input)
+}
+
+// UpdateTimeToLiveWithContext enables or disables time to live on the given
+// table.
+func (db *DynamoDB) UpdateTimeToLiveWithContext(ctx aws.Context, input *dynamodb.UpdateTimeToLiveInput, _ ...request.Option) (*dynamodb.UpdateTimeToLiveOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	spec := input.TimeToLiveSpecification
+	status := dynamodb.TimeToLiveStatusDisabled
+	if aws.BoolValue(spec.Enabled) {
+		status = dynamodb.TimeToLiveStatusEnabled
+	}
+	if t.timeToLive != nil && aws.StringValue(t.timeToLive.TimeToLiveStatus) == status {
+		return nil, validationError("TimeToLive is already %s", strings.ToLower(status))
+	}
+	t.timeToLive = &dynamodb.TimeToLiveDescription{
+		AttributeName:    spec.AttributeName,
+		TimeToLiveStatus: aws.String(status),
+	}
+	return &dynamodb.UpdateTimeToLiveOutput{
+		TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+			AttributeName: spec.AttributeName,
+			Enabled:       spec.Enabled,
+		},
+	}, nil
+}
+
+// DescribeTimeToLive returns the time to live setting of the given table.
+func (db *DynamoDB) DescribeTimeToLive(input *dynamodb.DescribeTimeToLiveInput) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	return db.DescribeTimeToLiveWithContext(context.Background(), input)
+}
+
+// DescribeTimeToLiveWithContext returns the time to live setting of the given
+// table.
+func (db *DynamoDB) DescribeTimeToLiveWithContext(ctx aws.Context, input *dynamodb.DescribeTimeToLiveInput, _ ...request.Option) (*dynamodb.DescribeTimeToLiveOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	desc := &dynamodb.TimeToLiveDescription{TimeToLiveStatus: aws.String(dynamodb.TimeToLiveStatusDisabled)}
+	if t.timeToLive != nil {
+		d := *t.timeToLive
+		desc = &d
+	}
+	return &dynamodb.DescribeTimeToLiveOutput{TimeToLiveDescription: desc}, nil
+}
+
+// keyOf validates that the given item or key has all the attributes of the
+// table's key schema and returns its internal representation. If exact is set,
+// no attribute other than the keys is allowed.
+func (t *table) keyOf(it item, exact bool) (string, error) {
+	keys := t.keyNames()
+	if exact && len(it) != len(keys) {
+		return "", validationError("The provided key element does not match the schema")
+	}
+	var parts []string
+	for _, k := range keys {
+		v, ok := it[k]
+		if !ok {
+			if exact {
+				return "", validationError("The provided key element does not match the schema")
+			}
+			return "", validationError("One or more parameter values were invalid: Missing the key %s in the item", k)
+		}
+		var s string
+		switch t.keyTypes[k] {
+		case dynamodb.ScalarAttributeTypeS:
+			if v.S == nil {
+				return "", validationError("One or more parameter values were invalid: Type mismatch for key %s expected: S", k)
+			}
+			s = *v.S
+		case dynamodb.ScalarAttributeTypeN:
+			if v.N == nil {
+				return "", validationError("One or more parameter values were invalid: Type mismatch for key %s expected: N", k)
+			}
+			n, err := parseNumber(*v.N)
+			if err != nil {
+				return "", validationError("%v", err)
+			}
+			s = formatNumber(n)
+		case dynamodb.ScalarAttributeTypeB:
+			if v.B == nil {
+				return "", validationError("One or more parameter values were invalid: Type mismatch for key %s expected: B", k)
+			}
+			s = string(v.B)
+		}
+		if s == "" {
+			return "", validationError("One or more parameter values are not valid. The AttributeValue for a key attribute cannot contain an empty string value. Key: %s", k)
+		}
+		parts = append(parts, fmt.Sprintf("%d:%s", len(s), s))
+	}
+	return strings.Join(parts, ""), nil
+}
+
+// writeRequest gathers the parts of a conditional write that are common to
+// PutItem, UpdateItem and DeleteItem.
+type writeRequest struct {
+	condition *string
+	update    *string
+	names     map[string]*string
+	values    map[string]*dynamodb.AttributeValue
+}
+
+// prepare parses the expressions of the request.
+func (w writeRequest) prepare() (condition, *update, error) {
+	ec := newExpressionContext(w.names, w.values)
+	var (
+		cond condition
+		upd  *update
+		err  error
+	)
+	if w.condition != nil {
+		if cond, err = parseCondition(ec, *w.condition); err != nil {
+			return nil, nil, validationError("Invalid ConditionExpression: %v", err)
+		}
+	}
+	if w.update != nil {
+		if upd, err = parseUpdate(ec, *w.update); err != nil {
+			return nil, nil, validationError("Invalid UpdateExpression: %v", err)
+		}
+	}
+	if err := ec.checkUnused(); err != nil {
+		return nil, nil, validationError("%v", err)
+	}
+	return cond, upd, nil
+}
+
+func checkCondition(cond condition, current item) error {
+	if cond == nil {
+		return nil
+	}
+	ok, err := cond.eval(current)
+	if err != nil {
+		return validationError("Invalid ConditionExpression: %v", err)
+	}
+	if !ok {
+		return requestFailure(dynamodb.ErrCodeConditionalCheckFailedException, "The conditional request failed")
+	}
+	return nil
+}
+
+func checkReturnValues(rv *string, allowed ...string) error {
+	if rv == nil {
+		return nil
+	}
+	for _, a := range allowed {
+		if *rv == a {
+			return nil
+		}
+	}
+	return validationError("ReturnValues can only be %s", strings.Join(allowed, " or "))
+}
+
+func unsupportedLegacyParameter(set bool, name string) error {
+	if set {
+		return validationError("%s is a legacy parameter not supported by dynamolocktest", name)
+	}
+	return nil
+}
+
+// GetItem returns the item with the given key.
+func (db *DynamoDB) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return db.GetItemWithContext(context.Background(), input)
+}
+
+// GetItemWithContext returns the item with the given key.
+func (db *DynamoDB) GetItemWithContext(ctx aws.Context, input *dynamodb.GetItemInput, _ ...request.Option) (*dynamodb.GetItemOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.AttributesToGet != nil || input.ProjectionExpression != nil, "Projection"); err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.keyOf(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	return &dynamodb.GetItemOutput{Item: copyItem(t.items[k])}, nil
+}
+
+// PutItem stores the given item, provided the condition expression holds.
+func (db *DynamoDB) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	return db.PutItemWithContext(context.Background(), input)
+}
+
+// PutItemWithContext stores the given item, provided the condition expression
+// holds.
+func (db *DynamoDB) PutItemWithContext(ctx aws.Context, input *dynamodb.PutItemInput, _ ...request.Option) (*dynamodb.PutItemOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.Expected != nil || input.ConditionalOperator != nil, "Expected"); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(input.ReturnValues, dynamodb.ReturnValueNone, dynamodb.ReturnValueAllOld); err != nil {
+		return nil, err
+	}
+	cond, _, err := writeRequest{
+		condition: input.ConditionExpression,
+		names:     input.ExpressionAttributeNames,
+		values:    input.ExpressionAttributeValues,
+	}.prepare()
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.keyOf(input.Item, false)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[k]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+	t.items[k] = copyItem(input.Item)
+	out := &dynamodb.PutItemOutput{}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+// UpdateItem edits or creates the item with the given key, provided the
+// condition expression holds.
+func (db *DynamoDB) UpdateItem(input *dynamodb.UpdateItemInput) (*dynamodb.UpdateItemOutput, error) {
+	return db.UpdateItemWithContext(context.Background(), input)
+}
+
+// UpdateItemWithContext edits or creates the item with the given key, provided
+// the condition expression holds.
+func (db *DynamoDB) UpdateItemWithContext(ctx aws.Context, input *dynamodb.UpdateItemInput, _ ...request.Option) (*dynamodb.UpdateItemOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.Expected != nil || input.ConditionalOperator != nil || input.AttributeUpdates != nil, "AttributeUpdates"); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(input.ReturnValues,
+		dynamodb.ReturnValueNone, dynamodb.ReturnValueAllOld, dynamodb.ReturnValueAllNew,
+		dynamodb.ReturnValueUpdatedOld, dynamodb.ReturnValueUpdatedNew); err != nil {
+		return nil, err
+	}
+	if input.UpdateExpression == nil {
+		return nil, validationError("UpdateExpression is required by dynamolocktest")
+	}
+	cond, upd, err := writeRequest{
+		condition: input.ConditionExpression,
+		update:    input.UpdateExpression,
+		names:     input.ExpressionAttributeNames,
+		values:    input.ExpressionAttributeValues,
+	}.prepare()
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.keyOf(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[k]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+	current := old
+	if current == nil {
+		current = copyItem(input.Key)
+	}
+	updated, touched, err := upd.apply(current)
+	if err != nil {
+		return nil, validationError("%v", err)
+	}
+	for _, attr := range touched {
+		if attr == t.hashKey || attr == t.rangeKey {
+			return nil, validationError("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", attr)
+		}
+	}
+	t.items[k] = updated
+	out := &dynamodb.UpdateItemOutput{}
+	switch aws.StringValue(input.ReturnValues) {
+	case dynamodb.ReturnValueAllOld:
+		out.Attributes = copyItem(old)
+	case dynamodb.ReturnValueAllNew:
+		out.Attributes = copyItem(updated)
+	case dynamodb.ReturnValueUpdatedOld:
+		out.Attributes = pick(old, touched)
+	case dynamodb.ReturnValueUpdatedNew:
+		out.Attributes = pick(updated, touched)
+	}
+	return out, nil
+}
+
+func pick(it item, attrs []string) item {
+	out := make(item)
+	for _, attr := range attrs {
+		if v, ok := it[attr]; ok {
+			out[attr] = copyAttributeValue(v)
+		}
+	}
+	return out
+}
+
+// DeleteItem removes the item with the given key, provided the condition
+// expression holds.
+func (db *DynamoDB) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	return db.DeleteItemWithContext(context.Background(), input)
+}
+
+// DeleteItemWithContext removes the item with the given key, provided the
+// condition expression holds.
+func (db *DynamoDB) DeleteItemWithContext(ctx aws.Context, input *dynamodb.DeleteItemInput, _ ...request.Option) (*dynamodb.DeleteItemOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.Expected != nil || input.ConditionalOperator != nil, "Expected"); err != nil {
+		return nil, err
+	}
+	if err := checkReturnValues(input.ReturnValues, dynamodb.ReturnValueNone, dynamodb.ReturnValueAllOld); err != nil {
+		return nil, err
+	}
+	cond, _, err := writeRequest{
+		condition: input.ConditionExpression,
+		names:     input.ExpressionAttributeNames,
+		values:    input.ExpressionAttributeValues,
+	}.prepare()
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	k, err := t.keyOf(input.Key, true)
+	if err != nil {
+		return nil, err
+	}
+	old := t.items[k]
+	if err := checkCondition(cond, old); err != nil {
+		return nil, err
+	}
+	delete(t.items, k)
+	out := &dynamodb.DeleteItemOutput{}
+	if aws.StringValue(input.ReturnValues) == dynamodb.ReturnValueAllOld {
+		out.Attributes = copyItem(old)
+	}
+	return out, nil
+}
+
+// transactWrite is one of the writes of a transaction, ready to be checked and
+// applied.
+type transactWrite struct {
+	tableName *string
+	key       item
+	exact     bool
+	condition condition
+	apply     func(t *table, old item) (item, error)
+}
+
+// TransactWriteItems applies all the given writes, or none of them if any of
+// their conditions does not hold.
+func (db *DynamoDB) TransactWriteItems(input *dynamodb.TransactWriteItemsInput) (*dynamodb.TransactWriteItemsOutput, error) {
+	return db.TransactWriteItemsWithContext(context.Background(), input)
+}
+
+// TransactWriteItemsWithContext applies all the given writes, or none of them
+// if any of their conditions does not hold. Put, Update, Delete and
+// ConditionCheck are supported.
+func (db *DynamoDB) TransactWriteItemsWithContext(ctx aws.Context, input *dynamodb.TransactWriteItemsInput, _ ...request.Option) (*dynamodb.TransactWriteItemsOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if len(input.TransactItems) > 25 {
+		return nil, validationError("Member must have length less than or equal to 25")
+	}
+	writes := make([]transactWrite, len(input.TransactItems))
+	for i, ti := range input.TransactItems {
+		w, err := prepareTransactWrite(ti)
+		if err != nil {
+			return nil, err
+		}
+		writes[i] = w
+	}
+
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	tables := make([]*table, len(writes))
+	keys := make([]string, len(writes))
+	seen := make(map[string]bool)
+	for i, w := range writes {
+		t, err := db.table(w.tableName)
+		if err != nil {
+			return nil, err
+		}
+		k, err := t.keyOf(w.key, w.exact)
+		if err != nil {
+			return nil, err
+		}
+		id := aws.StringValue(w.tableName) + "/" + k
+		if seen[id] {
+			return nil, validationError("Transaction request cannot include multiple operations on one item")
+		}
+		seen[id] = true
+		tables[i], keys[i] = t, k
+	}
+
+	reasons := make([]*dynamodb.CancellationReason, len(writes))
+	codes := make([]string, len(writes))
+	canceled := false
+	for i, w := range writes {
+		codes[i] = "None"
+		if err := checkCondition(w.condition, tables[i].items[keys[i]]); err != nil {
+			if errCode(err) != dynamodb.ErrCodeConditionalCheckFailedException {
+				return nil, err
+			}
+			codes[i] = "ConditionalCheckFailed"
+			canceled = true
+		}
+		reasons[i] = &dynamodb.CancellationReason{Code: aws.String(codes[i])}
+		if codes[i] != "None" {
+			reasons[i].Message = aws.String("The conditional request failed")
+		}
+	}
+	if canceled {
+		return nil, &dynamodb.TransactionCanceledException{
+			Message_:            aws.String(fmt.Sprintf("Transaction cancelled, please refer cancellation reasons for specific reasons [%s]", strings.Join(codes, ", "))),
+			CancellationReasons: reasons,
+		}
+	}
+
+	updated := make([]item, len(writes))
+	for i, w := range writes {
+		if w.apply == nil {
+			continue
+		}
+		it, err := w.apply(tables[i], tables[i].items[keys[i]])
+		if err != nil {
+			return nil, err
+		}
+		updated[i] = it
+	}
+	for i, w := range writes {
+		switch {
+		case w.apply == nil:
+		case updated[i] == nil:
+			delete(tables[i].items, keys[i])
+		default:
+			tables[i].items[keys[i]] = updated[i]
+		}
+	}
+	return &dynamodb.TransactWriteItemsOutput{}, nil
+}
+
+func errCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+// prepareTransactWrite parses the expressions of one of the writes of a
+// transaction.
+func prepareTransactWrite(ti *dynamodb.TransactWriteItem) (transactWrite, error) {
+	var ops int
+	for _, set := range []bool{ti.Put != nil, ti.Update != nil, ti.Delete != nil, ti.ConditionCheck != nil} {
+		if set {
+			ops++
+		}
+	}
+	if ops != 1 {
+		return transactWrite{}, validationError("TransactItems can only contain one of Check, Put, Update or Delete")
+	}
+	switch {
+	case ti.Put != nil:
+		put := ti.Put
+		cond, _, err := writeRequest{
+			condition: put.ConditionExpression,
+			names:     put.ExpressionAttributeNames,
+			values:    put.ExpressionAttributeValues,
+		}.prepare()
+		return transactWrite{
+			tableName: put.TableName,
+			key:       put.Item,
+			condition: cond,
+			apply: func(*table, item) (item, error) {
+				return copyItem(put.Item), nil
+			},
+		}, err
+	case ti.Update != nil:
+		upd := ti.Update
+		cond, u, err := writeRequest{
+			condition: upd.ConditionExpression,
+			update:    upd.UpdateExpression,
+			names:     upd.ExpressionAttributeNames,
+			values:    upd.ExpressionAttributeValues,
+		}.prepare()
+		return transactWrite{
+			tableName: upd.TableName,
+			key:       upd.Key,
+			exact:     true,
+			condition: cond,
+			apply: func(t *table, old item) (item, error) {
+				current := old
+				if current == nil {
+					current = copyItem(upd.Key)
+				}
+				updated, touched, err := u.apply(current)
+				if err != nil {
+					return nil, validationError("%v", err)
+				}
+				for _, attr := range touched {
+					if attr == t.hashKey || attr == t.rangeKey {
+						return nil, validationError("One or more parameter values were invalid: Cannot update attribute %s. This attribute is part of the key", attr)
+					}
+				}
+				return updated, nil
+			},
+		}, err
+	case ti.Delete != nil:
+		del := ti.Delete
+		cond, _, err := writeRequest{
+			condition: del.ConditionExpression,
+			names:     del.ExpressionAttributeNames,
+			values:    del.ExpressionAttributeValues,
+		}.prepare()
+		return transactWrite{
+			tableName: del.TableName,
+			key:       del.Key,
+			exact:     true,
+			condition: cond,
+			apply: func(*table, item) (item, error) {
+				return nil, nil
+			},
+		}, err
+	default:
+		check := ti.ConditionCheck
+		cond, _, err := writeRequest{
+			condition: check.ConditionExpression,
+			names:     check.ExpressionAttributeNames,
+			values:    check.ExpressionAttributeValues,
+		}.prepare()
+		return transactWrite{
+			tableName: check.TableName,
+			key:       check.Key,
+			exact:     true,
+			condition: cond,
+		}, err
+	}
+}
+
+// Scan returns the items of the given table in key order, one page at a time.
+func (db *DynamoDB) Scan(input *dynamodb.ScanInput) (*dynamodb.ScanOutput, error) {
+	return db.ScanWithContext(context.Background(), input)
+}
+
+// ScanWithContext returns the items of the given table in key order, one page
+// at a time. As in DynamoDB, Limit caps the number of items evaluated before
+// the filter expression is applied.
+func (db *DynamoDB) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, _ ...request.Option) (*dynamodb.ScanOutput, error) {
+	if err := checkContext(ctx); err != nil {
+		return nil, err
+	}
+	if err := input.Validate(); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.ScanFilter != nil || input.ConditionalOperator != nil, "ScanFilter"); err != nil {
+		return nil, err
+	}
+	if err := unsupportedLegacyParameter(input.AttributesToGet != nil || input.ProjectionExpression != nil, "Projection"); err != nil {
+		return nil, err
+	}
+	if input.IndexName != nil || input.Segment != nil || input.TotalSegments != nil || input.Select != nil {
+		return nil, validationError("indexes, parallel scans and Select are not supported by dynamolocktest")
+	}
+	filter, _, err := writeRequest{
+		condition: input.FilterExpression,
+		names:     input.ExpressionAttributeNames,
+		values:    input.ExpressionAttributeValues,
+	}.prepare()
+	if err != nil {
+		return nil, err
+	}
+	db.mu.Lock()
+	defer db.mu.Unlock()
+	t, err := db.table(input.TableName)
+	if err != nil {
+		return nil, err
+	}
+	var start string
+	if input.ExclusiveStartKey != nil {
+		if start, err = t.keyOf(input.ExclusiveStartKey, true); err != nil {
+			return nil, err
+		}
+	}
+	keys := make([]string, 0, len(t.items))
+	for k := range t.items {
+		if input.ExclusiveStartKey == nil || k > start {
+			keys = append(keys, k)
+		}
+	}
+	sort.Strings(keys)
+	out := &dynamodb.ScanOutput{
+		Count:        aws.Int64(0),
+		ScannedCount: aws.Int64(0),
+	}
+	for i, k := range keys {
+		if input.Limit != nil && int64(i) == *input.Limit {
+			out.LastEvaluatedKey = t.keyAttributes(t.items[keys[i-1]])
+			break
+		}
+		*out.ScannedCount++
+		it := t.items[k]
+		if filter != nil {
+			ok, err := filter.eval(it)
+			if err != nil {
+				return nil, validationError("Invalid FilterExpression: %v", err)
+			}
+			if !ok {
+				continue
+			}
+		}
+		*out.Count++
+		out.Items = append(out.Items, copyItem(it))
+	}
+	return out, nil
+}
+
+func (t *table) keyNames() []string {
+	keys := []string{t.hashKey}
+	if t.rangeKey != "" {
+		keys = append(keys, t.rangeKey)
+	}
+	return keys
+}
+
+func (t *table) keyAttributes(it item) item {
+	return pick(it, t.keyNames())
+}
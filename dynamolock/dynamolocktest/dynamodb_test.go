@@ -0,0 +1,369 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolocktest_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"cirello.io/dynamolock/dynamolocktest"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func newTable(t *testing.T) *dynamolocktest.DynamoDB {
+	t.Helper()
+	db := dynamolocktest.New()
+	_, err := db.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String("locks"),
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String("key"),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		}},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String("key"),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return db
+}
+
+func errCode(err error) string {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code()
+	}
+	return ""
+}
+
+func key(k string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{"key": {S: aws.String(k)}}
+}
+
+func TestCreateTable(t *testing.T) {
+	db := newTable(t)
+	_, err := db.CreateTable(&dynamodb.CreateTableInput{
+		TableName: aws.String("locks"),
+		KeySchema: []*dynamodb.KeySchemaElement{{
+			AttributeName: aws.String("key"),
+			KeyType:       aws.String(dynamodb.KeyTypeHash),
+		}},
+		AttributeDefinitions: []*dynamodb.AttributeDefinition{{
+			AttributeName: aws.String("key"),
+			AttributeType: aws.String(dynamodb.ScalarAttributeTypeS),
+		}},
+	})
+	if errCode(err) != dynamodb.ErrCodeResourceInUseException {
+		t.Fatal("expected error for preexisting table:", err)
+	}
+	if _, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("missing"), Key: key("k")}); errCode(err) != dynamodb.ErrCodeResourceNotFoundException {
+		t.Fatal("expected error for missing table:", err)
+	}
+}
+
+func TestConditionalPut(t *testing.T) {
+	db := newTable(t)
+	put := func(rvn string) error {
+		_, err := db.PutItem(&dynamodb.PutItemInput{
+			TableName: aws.String("locks"),
+			Item: map[string]*dynamodb.AttributeValue{
+				"key":                 {S: aws.String("k")},
+				"recordVersionNumber": {S: aws.String(rvn)},
+			},
+			ConditionExpression: aws.String("attribute_not_exists(#pk) OR (attribute_exists(#pk) AND #ir = :ir)"),
+			ExpressionAttributeNames: map[string]*string{
+				"#pk": aws.String("key"),
+				"#ir": aws.String("isReleased"),
+			},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":ir": {S: aws.String("1")},
+			},
+		})
+		return err
+	}
+	if err := put("rvn1"); err != nil {
+		t.Fatal("first put must succeed:", err)
+	}
+	if err := put("rvn2"); errCode(err) != dynamodb.ErrCodeConditionalCheckFailedException {
+		t.Fatal("second put must fail the condition:", err)
+	}
+	_, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+		TableName:           aws.String("locks"),
+		Key:                 key("k"),
+		UpdateExpression:    aws.String("SET #ir = :ir"),
+		ConditionExpression: aws.String("attribute_exists(#pk) AND #rvn = :rvn"),
+		ExpressionAttributeNames: map[string]*string{
+			"#pk":  aws.String("key"),
+			"#ir":  aws.String("isReleased"),
+			"#rvn": aws.String("recordVersionNumber"),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":ir":  {S: aws.String("1")},
+			":rvn": {S: aws.String("rvn1")},
+		},
+	})
+	if err != nil {
+		t.Fatal("release must succeed:", err)
+	}
+	if err := put("rvn3"); err != nil {
+		t.Fatal("put on released item must succeed:", err)
+	}
+}
+
+func TestUpdateExpressions(t *testing.T) {
+	db := newTable(t)
+	update := func(expr string, values map[string]*dynamodb.AttributeValue) map[string]*dynamodb.AttributeValue {
+		t.Helper()
+		out, err := db.UpdateItem(&dynamodb.UpdateItemInput{
+			TableName:        aws.String("locks"),
+			Key:              key("k"),
+			UpdateExpression: aws.String(expr),
+			ExpressionAttributeNames: map[string]*string{
+				"#c": aws.String("counter"),
+				"#d": aws.String("data"),
+			},
+			ExpressionAttributeValues: values,
+			ReturnValues:              aws.String(dynamodb.ReturnValueAllNew),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Attributes
+	}
+	one := &dynamodb.AttributeValue{N: aws.String("1")}
+	got := update("SET #c = if_not_exists(#c, :zero) + :one, #d = :d", map[string]*dynamodb.AttributeValue{
+		":zero": {N: aws.String("0")},
+		":one":  one,
+		":d":    {B: []byte("data")},
+	})
+	if n := aws.StringValue(got["counter"].N); n != "1" {
+		t.Fatal("unexpected counter after SET:", n)
+	}
+	got = update("ADD #c :one REMOVE #d", map[string]*dynamodb.AttributeValue{":one": one})
+	if n := aws.StringValue(got["counter"].N); n != "2" {
+		t.Fatal("unexpected counter after ADD:", n)
+	}
+	if _, ok := got["data"]; ok {
+		t.Fatal("data should have been removed")
+	}
+}
+
+func TestExpressionValidation(t *testing.T) {
+	db := newTable(t)
+	tests := []struct {
+		name   string
+		cond   string
+		names  map[string]*string
+		values map[string]*dynamodb.AttributeValue
+	}{
+		{"unused name", "attribute_not_exists(#pk)", map[string]*string{"#pk": aws.String("key"), "#x": aws.String("x")}, nil},
+		{"unused value", "attribute_not_exists(#pk)", map[string]*string{"#pk": aws.String("key")}, map[string]*dynamodb.AttributeValue{":x": {S: aws.String("x")}}},
+		{"undefined name", "attribute_not_exists(#pk)", nil, nil},
+		{"undefined value", "#pk = :v", map[string]*string{"#pk": aws.String("key")}, nil},
+		{"syntax error", "attribute_not_exists(#pk", map[string]*string{"#pk": aws.String("key")}, nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := db.PutItem(&dynamodb.PutItemInput{
+				TableName:                 aws.String("locks"),
+				Item:                      key("k"),
+				ConditionExpression:       aws.String(tt.cond),
+				ExpressionAttributeNames:  tt.names,
+				ExpressionAttributeValues: tt.values,
+			})
+			if errCode(err) != "ValidationException" {
+				t.Fatal("expected validation error:", err)
+			}
+		})
+	}
+}
+
+func TestItemsAreCopied(t *testing.T) {
+	db := newTable(t)
+	item := key("k")
+	item["data"] = &dynamodb.AttributeValue{S: aws.String("original")}
+	if _, err := db.PutItem(&dynamodb.PutItemInput{TableName: aws.String("locks"), Item: item}); err != nil {
+		t.Fatal(err)
+	}
+	*item["data"].S = "changed"
+	out, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("locks"), Key: key("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	delete(out.Item, "data")
+	out, err = db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("locks"), Key: key("k")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := aws.StringValue(out.Item["data"].S); got != "original" {
+		t.Fatal("stored item was changed from outside:", got)
+	}
+}
+
+func TestCanceledContext(t *testing.T) {
+	db := newTable(t)
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := db.GetItemWithContext(ctx, &dynamodb.GetItemInput{TableName: aws.String("locks"), Key: key("k")})
+	if errCode(err) != request.CanceledErrorCode {
+		t.Fatal("expected canceled request:", err)
+	}
+}
+
+func TestScan(t *testing.T) {
+	db := newTable(t)
+	for _, k := range []string{"a", "b", "c", "d", "e"} {
+		it := key(k)
+		it["owner"] = &dynamodb.AttributeValue{S: aws.String("owner-" + k)}
+		if k == "c" {
+			it["owner"] = &dynamodb.AttributeValue{S: aws.String("other")}
+		}
+		if _, err := db.PutItem(&dynamodb.PutItemInput{TableName: aws.String("locks"), Item: it}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var (
+		got   []string
+		start map[string]*dynamodb.AttributeValue
+		pages int
+	)
+	for {
+		out, err := db.Scan(&dynamodb.ScanInput{
+			TableName:                aws.String("locks"),
+			Limit:                    aws.Int64(2),
+			ExclusiveStartKey:        start,
+			FilterExpression:         aws.String("begins_with(#o, :prefix)"),
+			ExpressionAttributeNames: map[string]*string{"#o": aws.String("owner")},
+			ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+				":prefix": {S: aws.String("owner-")},
+			},
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pages++
+		for _, it := range out.Items {
+			got = append(got, aws.StringValue(it["key"].S))
+		}
+		if len(out.LastEvaluatedKey) == 0 {
+			break
+		}
+		start = out.LastEvaluatedKey
+	}
+	if pages != 3 {
+		t.Fatal("unexpected number of pages:", pages)
+	}
+	if strings.Join(got, ",") != "a,b,d,e" {
+		t.Fatal("unexpected items:", got)
+	}
+}
+
+func TestTimeToLive(t *testing.T) {
+	db := newTable(t)
+	describe := func() *dynamodb.TimeToLiveDescription {
+		t.Helper()
+		out, err := db.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: aws.String("locks")})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.TimeToLiveDescription
+	}
+	if got := aws.StringValue(describe().TimeToLiveStatus); got != dynamodb.TimeToLiveStatusDisabled {
+		t.Fatal("time to live should start disabled:", got)
+	}
+	update := func(enabled bool) error {
+		_, err := db.UpdateTimeToLive(&dynamodb.UpdateTimeToLiveInput{
+			TableName: aws.String("locks"),
+			TimeToLiveSpecification: &dynamodb.TimeToLiveSpecification{
+				AttributeName: aws.String("expiresAt"),
+				Enabled:       aws.Bool(enabled),
+			},
+		})
+		return err
+	}
+	if err := update(true); err != nil {
+		t.Fatal(err)
+	}
+	if desc := describe(); aws.StringValue(desc.TimeToLiveStatus) != dynamodb.TimeToLiveStatusEnabled || aws.StringValue(desc.AttributeName) != "expiresAt" {
+		t.Fatal("unexpected time to live:", desc)
+	}
+	if err := update(true); errCode(err) != "ValidationException" {
+		t.Fatal("expected error enabling time to live twice:", err)
+	}
+}
+
+func TestTransactWriteItems(t *testing.T) {
+	db := newTable(t)
+	put := func(k string) *dynamodb.TransactWriteItem {
+		return &dynamodb.TransactWriteItem{Put: &dynamodb.Put{
+			TableName:                aws.String("locks"),
+			Item:                     map[string]*dynamodb.AttributeValue{"key": {S: aws.String(k)}},
+			ConditionExpression:      aws.String("attribute_not_exists(#pk)"),
+			ExpressionAttributeNames: map[string]*string{"#pk": aws.String("key")},
+		}}
+	}
+	get := func(k string) map[string]*dynamodb.AttributeValue {
+		t.Helper()
+		out, err := db.GetItem(&dynamodb.GetItemInput{TableName: aws.String("locks"), Key: key(k)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out.Item
+	}
+	if _, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{put("a"), put("b")},
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if get("a") == nil || get("b") == nil {
+		t.Fatal("all items should have been written")
+	}
+
+	_, err := db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{
+			{Delete: &dynamodb.Delete{TableName: aws.String("locks"), Key: key("a")}},
+			put("b"),
+			put("c"),
+		},
+	})
+	tce, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		t.Fatal("expected canceled transaction:", err)
+	}
+	var codes []string
+	for _, r := range tce.CancellationReasons {
+		codes = append(codes, aws.StringValue(r.Code))
+	}
+	if got := strings.Join(codes, ","); got != "None,ConditionalCheckFailed,None" {
+		t.Fatal("unexpected cancellation reasons:", got)
+	}
+	if get("a") == nil || get("c") != nil {
+		t.Fatal("canceled transaction must not write any item")
+	}
+
+	_, err = db.TransactWriteItems(&dynamodb.TransactWriteItemsInput{
+		TransactItems: []*dynamodb.TransactWriteItem{put("c"), put("c")},
+	})
+	if errCode(err) != "ValidationException" {
+		t.Fatal("expected error for repeated item:", err)
+	}
+}
@@ -0,0 +1,991 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolocktest
+
+import (
+	"bytes"
+	"fmt"
+	"math/big"
+	"reflect"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type item = map[string]*dynamodb.AttributeValue
+
+type tokenKind int
+
+const (
+	tokEOF tokenKind = iota
+	tokIdent
+	tokName
+	tokValue
+	tokPunct
+)
+
+type token struct {
+	kind tokenKind
+	text string
+}
+
+func (t token) is(text string) bool {
+	if t.kind == tokIdent {
+		return strings.EqualFold(t.text, text)
+	}
+	return t.kind == tokPunct && t.text == text
+}
+
+func isIdentRune(r byte) bool {
+	return r == '_' || r >= 'a' && r <= 'z' || r >= 'A' && r <= 'Z' || r >= '0' && r <= '9'
+}
+
+func tokenize(s string) ([]token, error) {
+	var tokens []token
+	for i := 0; i < len(s); {
+		switch c := s[i]; {
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+			i++
+		case c == '#' || c == ':':
+			j := i + 1
+			for j < len(s) && isIdentRune(s[j]) {
+				j++
+			}
+			if j == i+1 {
+				return nil, fmt.Errorf("syntax error; token: %q", string(c))
+			}
+			kind := tokName
+			if c == ':' {
+				kind = tokValue
+			}
+			tokens = append(tokens, token{kind, s[i:j]})
+			i = j
+		case isIdentRune(c):
+			j := i
+			for j < len(s) && isIdentRune(s[j]) {
+				j++
+			}
+			tokens = append(tokens, token{tokIdent, s[i:j]})
+			i = j
+		case c == '<' || c == '>':
+			if i+1 < len(s) && (s[i+1] == '=' || c == '<' && s[i+1] == '>') {
+				tokens = append(tokens, token{tokPunct, s[i : i+2]})
+				i += 2
+				continue
+			}
+			tokens = append(tokens, token{tokPunct, string(c)})
+			i++
+		case strings.IndexByte("(),.=+-", c) >= 0:
+			tokens = append(tokens, token{tokPunct, string(c)})
+			i++
+		default:
+			return nil, fmt.Errorf("syntax error; token: %q", string(c))
+		}
+	}
+	return append(tokens, token{kind: tokEOF}), nil
+}
+
+// expressionContext holds the placeholders shared by all the expressions of a
+// single request, tracking which ones were actually used.
+type expressionContext struct {
+	names      map[string]*string
+	values     map[string]*dynamodb.AttributeValue
+	usedNames  map[string]bool
+	usedValues map[string]bool
+}
+
+func newExpressionContext(names map[string]*string, values map[string]*dynamodb.AttributeValue) *expressionContext {
+	return &expressionContext{
+		names:      names,
+		values:     values,
+		usedNames:  make(map[string]bool),
+		usedValues: make(map[string]bool),
+	}
+}
+
+// checkUnused mimics DynamoDB's refusal to process requests carrying
+// placeholders that are not referenced by any expression.
+func (ec *expressionContext) checkUnused() error {
+	var unusedNames, unusedValues []string
+	for k := range ec.names {
+		if !ec.usedNames[k] {
+			unusedNames = append(unusedNames, k)
+		}
+	}
+	for k := range ec.values {
+		if !ec.usedValues[k] {
+			unusedValues = append(unusedValues, k)
+		}
+	}
+	sort.Strings(unusedNames)
+	sort.Strings(unusedValues)
+	if len(unusedNames) > 0 {
+		return fmt.Errorf("Value provided in ExpressionAttributeNames unused in expressions: keys: {%s}", strings.Join(unusedNames, ", "))
+	}
+	if len(unusedValues) > 0 {
+		return fmt.Errorf("Value provided in ExpressionAttributeValues unused in expressions: keys: {%s}", strings.Join(unusedValues, ", "))
+	}
+	return nil
+}
+
+type parser struct {
+	ec     *expressionContext
+	tokens []token
+	pos    int
+}
+
+func newParser(ec *expressionContext, expr string) (*parser, error) {
+	tokens, err := tokenize(expr)
+	if err != nil {
+		return nil, err
+	}
+	return &parser{ec: ec, tokens: tokens}, nil
+}
+
+func (p *parser) peek() token {
+	return p.tokens[p.pos]
+}
+
+func (p *parser) next() token {
+	t := p.tokens[p.pos]
+	if t.kind != tokEOF {
+		p.pos++
+	}
+	return t
+}
+
+func (p *parser) accept(text string) bool {
+	if p.peek().is(text) {
+		p.pos++
+		return true
+	}
+	return false
+}
+
+func (p *parser) expect(text string) error {
+	if !p.accept(text) {
+		return p.unexpected()
+	}
+	return nil
+}
+
+func (p *parser) unexpected() error {
+	t := p.peek()
+	if t.kind == tokEOF {
+		return fmt.Errorf("syntax error; token: <EOF>")
+	}
+	return fmt.Errorf("syntax error; token: %q", t.text)
+}
+
+func (p *parser) end() error {
+	if p.peek().kind != tokEOF {
+		return p.unexpected()
+	}
+	return nil
+}
+
+type path []string
+
+func (p *parser) parsePath() (path, error) {
+	var pa path
+	for {
+		t := p.next()
+		switch t.kind {
+		case tokIdent:
+			pa = append(pa, t.text)
+		case tokName:
+			name, ok := p.ec.names[t.text]
+			if !ok {
+				return nil, fmt.Errorf("An expression attribute name used in the document path is not defined; attribute name: %s", t.text)
+			}
+			p.ec.usedNames[t.text] = true
+			pa = append(pa, aws.StringValue(name))
+		default:
+			p.pos--
+			return nil, p.unexpected()
+		}
+		if !p.accept(".") {
+			return pa, nil
+		}
+	}
+}
+
+// operand is any expression that evaluates to an attribute value. A nil value
+// means that the operand refers to a missing attribute.
+type operand interface {
+	eval(it item) (*dynamodb.AttributeValue, error)
+}
+
+type pathOperand path
+
+func (o pathOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	return lookup(it, path(o)), nil
+}
+
+type valueOperand struct {
+	v *dynamodb.AttributeValue
+}
+
+func (o valueOperand) eval(item) (*dynamodb.AttributeValue, error) {
+	return o.v, nil
+}
+
+type sizeOperand path
+
+func (o sizeOperand) eval(it item) (*dynamodb.AttributeValue, error) {
+	v := lookup(it, path(o))
+	if v == nil {
+		return nil, nil
+	}
+	var n int
+	switch {
+	case v.S != nil:
+		n = len(aws.StringValue(v.S))
+	case v.B != nil:
+		n = len(v.B)
+	case v.SS != nil:
+		n = len(v.SS)
+	case v.NS != nil:
+		n = len(v.NS)
+	case v.BS != nil:
+		n = len(v.BS)
+	case v.L != nil:
+		n = len(v.L)
+	case v.M != nil:
+		n = len(v.M)
+	default:
+		return nil, nil
+	}
+	return &dynamodb.AttributeValue{N: aws.String(fmt.Sprint(n))}, nil
+}
+
+func (p *parser) parseOperand() (operand, error) {
+	t := p.peek()
+	switch {
+	case t.kind == tokValue:
+		p.next()
+		v, ok := p.ec.values[t.text]
+		if !ok {
+			return nil, fmt.Errorf("An expression attribute value used in expression is not defined; attribute value: %s", t.text)
+		}
+		p.ec.usedValues[t.text] = true
+		return valueOperand{v}, nil
+	case t.is("size") && p.tokens[p.pos+1].is("("):
+		p.pos += 2
+		pa, err := p.parsePath()
+		if err != nil {
+			return nil, err
+		}
+		return sizeOperand(pa), p.expect(")")
+	}
+	pa, err := p.parsePath()
+	if err != nil {
+		return nil, err
+	}
+	return pathOperand(pa), nil
+}
+
+// condition is a parsed ConditionExpression.
+type condition interface {
+	eval(it item) (bool, error)
+}
+
+type andCondition struct{ l, r condition }
+
+func (c andCondition) eval(it item) (bool, error) {
+	l, err := c.l.eval(it)
+	if err != nil || !l {
+		return false, err
+	}
+	return c.r.eval(it)
+}
+
+type orCondition struct{ l, r condition }
+
+func (c orCondition) eval(it item) (bool, error) {
+	l, err := c.l.eval(it)
+	if err != nil || l {
+		return l, err
+	}
+	return c.r.eval(it)
+}
+
+type notCondition struct{ c condition }
+
+func (c notCondition) eval(it item) (bool, error) {
+	ok, err := c.c.eval(it)
+	return !ok, err
+}
+
+type existsCondition struct {
+	path   path
+	exists bool
+}
+
+func (c existsCondition) eval(it item) (bool, error) {
+	return (lookup(it, c.path) != nil) == c.exists, nil
+}
+
+type beginsWithCondition struct{ l, r operand }
+
+func (c beginsWithCondition) eval(it item) (bool, error) {
+	l, err := c.l.eval(it)
+	if err != nil {
+		return false, err
+	}
+	r, err := c.r.eval(it)
+	if err != nil || l == nil || r == nil {
+		return false, err
+	}
+	switch {
+	case l.S != nil && r.S != nil:
+		return strings.HasPrefix(*l.S, *r.S), nil
+	case l.B != nil && r.B != nil:
+		return bytes.HasPrefix(l.B, r.B), nil
+	}
+	return false, nil
+}
+
+type comparisonCondition struct {
+	op   string
+	l, r operand
+}
+
+func (c comparisonCondition) eval(it item) (bool, error) {
+	l, err := c.l.eval(it)
+	if err != nil {
+		return false, err
+	}
+	r, err := c.r.eval(it)
+	if err != nil {
+		return false, err
+	}
+	if c.op == "<>" {
+		return l == nil || r == nil || !equal(l, r), nil
+	}
+	if l == nil || r == nil {
+		return false, nil
+	}
+	if c.op == "=" {
+		return equal(l, r), nil
+	}
+	cmp, ok := compare(l, r)
+	if !ok {
+		return false, nil
+	}
+	switch c.op {
+	case "<":
+		return cmp < 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	default:
+		return cmp >= 0, nil
+	}
+}
+
+func parseCondition(ec *expressionContext, expr string) (condition, error) {
+	p, err := newParser(ec, expr)
+	if err != nil {
+		return nil, err
+	}
+	c, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+	return c, p.end()
+}
+
+func (p *parser) parseOr() (condition, error) {
+	l, err := p.parseAnd()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("OR") {
+		r, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		l = orCondition{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseAnd() (condition, error) {
+	l, err := p.parseNot()
+	if err != nil {
+		return nil, err
+	}
+	for p.accept("AND") {
+		r, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		l = andCondition{l, r}
+	}
+	return l, nil
+}
+
+func (p *parser) parseNot() (condition, error) {
+	if p.accept("NOT") {
+		c, err := p.parseNot()
+		if err != nil {
+			return nil, err
+		}
+		return notCondition{c}, nil
+	}
+	return p.parsePrimary()
+}
+
+func (p *parser) parsePrimary() (condition, error) {
+	if p.accept("(") {
+		c, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		return c, p.expect(")")
+	}
+	t := p.peek()
+	if t.kind == tokIdent && p.tokens[p.pos+1].is("(") {
+		switch fn := strings.ToLower(t.text); fn {
+		case "attribute_exists", "attribute_not_exists":
+			p.pos += 2
+			pa, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			return existsCondition{pa, fn == "attribute_exists"}, p.expect(")")
+		case "begins_with":
+			p.pos += 2
+			l, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			r, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return beginsWithCondition{l, r}, p.expect(")")
+		case "size":
+		default:
+			return nil, fmt.Errorf("Invalid function name; function: %s", t.text)
+		}
+	}
+	l, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	op := p.next()
+	if op.kind != tokPunct {
+		p.pos--
+		return nil, p.unexpected()
+	}
+	switch op.text {
+	case "=", "<>", "<", "<=", ">", ">=":
+	default:
+		p.pos--
+		return nil, p.unexpected()
+	}
+	r, err := p.parseOperand()
+	if err != nil {
+		return nil, err
+	}
+	return comparisonCondition{op.text, l, r}, nil
+}
+
+// update is a parsed UpdateExpression.
+type update struct {
+	actions []updateAction
+}
+
+type updateAction struct {
+	kind  string
+	path  path
+	value valueExpr
+}
+
+// valueExpr is the right-hand side of SET, ADD and DELETE actions.
+type valueExpr interface {
+	eval(it item) (*dynamodb.AttributeValue, error)
+}
+
+type ifNotExistsExpr struct {
+	path  path
+	value operand
+}
+
+func (e ifNotExistsExpr) eval(it item) (*dynamodb.AttributeValue, error) {
+	if v := lookup(it, e.path); v != nil {
+		return v, nil
+	}
+	return e.value.eval(it)
+}
+
+type arithmeticExpr struct {
+	op   string
+	l, r valueExpr
+}
+
+func (e arithmeticExpr) eval(it item) (*dynamodb.AttributeValue, error) {
+	l, err := mustEval(it, e.l)
+	if err != nil {
+		return nil, err
+	}
+	r, err := mustEval(it, e.r)
+	if err != nil {
+		return nil, err
+	}
+	if l.N == nil || r.N == nil {
+		return nil, fmt.Errorf("An operand in the update expression has an incorrect data type")
+	}
+	a, err := parseNumber(*l.N)
+	if err != nil {
+		return nil, err
+	}
+	b, err := parseNumber(*r.N)
+	if err != nil {
+		return nil, err
+	}
+	if e.op == "+" {
+		a.Add(a, b)
+	} else {
+		a.Sub(a, b)
+	}
+	return &dynamodb.AttributeValue{N: aws.String(formatNumber(a))}, nil
+}
+
+type listAppendExpr struct{ l, r valueExpr }
+
+func (e listAppendExpr) eval(it item) (*dynamodb.AttributeValue, error) {
+	l, err := mustEval(it, e.l)
+	if err != nil {
+		return nil, err
+	}
+	r, err := mustEval(it, e.r)
+	if err != nil {
+		return nil, err
+	}
+	if l.L == nil || r.L == nil {
+		return nil, fmt.Errorf("An operand in the update expression has an incorrect data type")
+	}
+	list := append(append([]*dynamodb.AttributeValue{}, l.L...), r.L...)
+	return &dynamodb.AttributeValue{L: list}, nil
+}
+
+func mustEval(it item, e valueExpr) (*dynamodb.AttributeValue, error) {
+	v, err := e.eval(it)
+	if err != nil {
+		return nil, err
+	}
+	if v == nil {
+		return nil, fmt.Errorf("The provided expression refers to an attribute that does not exist in the item")
+	}
+	return v, nil
+}
+
+func parseUpdate(ec *expressionContext, expr string) (*update, error) {
+	p, err := newParser(ec, expr)
+	if err != nil {
+		return nil, err
+	}
+	u := &update{}
+	seen := make(map[string]bool)
+	for p.peek().kind != tokEOF {
+		clause := strings.ToUpper(p.next().text)
+		if seen[clause] {
+			return nil, fmt.Errorf("The %q section can only be used once in an update expression", clause)
+		}
+		seen[clause] = true
+		switch clause {
+		case "SET", "REMOVE", "ADD", "DELETE":
+		default:
+			p.pos--
+			return nil, p.unexpected()
+		}
+		for {
+			a, err := p.parseAction(clause)
+			if err != nil {
+				return nil, err
+			}
+			u.actions = append(u.actions, a)
+			if !p.accept(",") {
+				break
+			}
+		}
+	}
+	if len(u.actions) == 0 {
+		return nil, p.unexpected()
+	}
+	return u, nil
+}
+
+func (p *parser) parseAction(kind string) (updateAction, error) {
+	pa, err := p.parsePath()
+	if err != nil {
+		return updateAction{}, err
+	}
+	a := updateAction{kind: kind, path: pa}
+	switch kind {
+	case "SET":
+		if err := p.expect("="); err != nil {
+			return a, err
+		}
+		l, err := p.parseSetOperand()
+		if err != nil {
+			return a, err
+		}
+		if t := p.peek(); t.is("+") || t.is("-") {
+			p.next()
+			r, err := p.parseSetOperand()
+			if err != nil {
+				return a, err
+			}
+			l = arithmeticExpr{t.text, l, r}
+		}
+		a.value = l
+	case "ADD", "DELETE":
+		v, err := p.parseOperand()
+		if err != nil {
+			return a, err
+		}
+		if _, ok := v.(valueOperand); !ok {
+			return a, fmt.Errorf("Incorrect operand type for operator or function; operator: %s", kind)
+		}
+		a.value = v
+	}
+	return a, nil
+}
+
+func (p *parser) parseSetOperand() (valueExpr, error) {
+	t := p.peek()
+	if t.kind == tokIdent && p.tokens[p.pos+1].is("(") {
+		switch strings.ToLower(t.text) {
+		case "if_not_exists":
+			p.pos += 2
+			pa, err := p.parsePath()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			v, err := p.parseOperand()
+			if err != nil {
+				return nil, err
+			}
+			return ifNotExistsExpr{pa, v}, p.expect(")")
+		case "list_append":
+			p.pos += 2
+			l, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			if err := p.expect(","); err != nil {
+				return nil, err
+			}
+			r, err := p.parseSetOperand()
+			if err != nil {
+				return nil, err
+			}
+			return listAppendExpr{l, r}, p.expect(")")
+		default:
+			return nil, fmt.Errorf("Invalid function name; function: %s", t.text)
+		}
+	}
+	return p.parseOperand()
+}
+
+// apply runs the update against a copy of the item. All the right-hand side
+// values are evaluated against the original item, as DynamoDB does. It returns
+// the updated item and the top-level attributes touched by the update.
+func (u *update) apply(orig item) (item, []string, error) {
+	values := make([]*dynamodb.AttributeValue, len(u.actions))
+	for i, a := range u.actions {
+		if a.value == nil {
+			continue
+		}
+		v, err := a.value.eval(orig)
+		if err != nil {
+			return nil, nil, err
+		}
+		if v == nil {
+			return nil, nil, fmt.Errorf("The provided expression refers to an attribute that does not exist in the item")
+		}
+		values[i] = v
+	}
+	it := copyItem(orig)
+	touched := make(map[string]bool)
+	for i, a := range u.actions {
+		touched[a.path[0]] = true
+		var err error
+		switch a.kind {
+		case "SET":
+			err = store(it, a.path, copyAttributeValue(values[i]))
+		case "REMOVE":
+			err = remove(it, a.path)
+		case "ADD":
+			err = add(it, a.path, values[i])
+		case "DELETE":
+			err = deleteFromSet(it, a.path, values[i])
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+	var names []string
+	for k := range touched {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	return it, names, nil
+}
+
+func lookup(it item, pa path) *dynamodb.AttributeValue {
+	v, ok := it[pa[0]]
+	if !ok {
+		return nil
+	}
+	for _, k := range pa[1:] {
+		if v.M == nil {
+			return nil
+		}
+		if v, ok = v.M[k]; !ok {
+			return nil
+		}
+	}
+	return v
+}
+
+func parent(it item, pa path) (map[string]*dynamodb.AttributeValue, error) {
+	m := it
+	for _, k := range pa[:len(pa)-1] {
+		v, ok := m[k]
+		if !ok || v.M == nil {
+			return nil, fmt.Errorf("The document path provided in the update expression is invalid for update")
+		}
+		m = v.M
+	}
+	return m, nil
+}
+
+func store(it item, pa path, v *dynamodb.AttributeValue) error {
+	m, err := parent(it, pa)
+	if err != nil {
+		return err
+	}
+	m[pa[len(pa)-1]] = v
+	return nil
+}
+
+func remove(it item, pa path) error {
+	m, err := parent(it, pa)
+	if err != nil {
+		// removing an attribute that does not exist is a no-op.
+		return nil
+	}
+	delete(m, pa[len(pa)-1])
+	return nil
+}
+
+func add(it item, pa path, v *dynamodb.AttributeValue) error {
+	current := lookup(it, pa)
+	switch {
+	case current == nil:
+		return store(it, pa, copyAttributeValue(v))
+	case current.N != nil && v.N != nil:
+		a, err := parseNumber(*current.N)
+		if err != nil {
+			return err
+		}
+		b, err := parseNumber(*v.N)
+		if err != nil {
+			return err
+		}
+		current.N = aws.String(formatNumber(a.Add(a, b)))
+	case current.SS != nil && v.SS != nil:
+		current.SS = union(current.SS, v.SS)
+	case current.NS != nil && v.NS != nil:
+		current.NS = union(current.NS, v.NS)
+	default:
+		return fmt.Errorf("An operand in the update expression has an incorrect data type")
+	}
+	return nil
+}
+
+func deleteFromSet(it item, pa path, v *dynamodb.AttributeValue) error {
+	current := lookup(it, pa)
+	switch {
+	case current == nil:
+		return nil
+	case current.SS != nil && v.SS != nil:
+		current.SS = difference(current.SS, v.SS)
+		if len(current.SS) == 0 {
+			return remove(it, pa)
+		}
+	case current.NS != nil && v.NS != nil:
+		current.NS = difference(current.NS, v.NS)
+		if len(current.NS) == 0 {
+			return remove(it, pa)
+		}
+	default:
+		return fmt.Errorf("An operand in the update expression has an incorrect data type")
+	}
+	return nil
+}
+
+func union(a, b []*string) []*string {
+	seen := make(map[string]bool)
+	var out []*string
+	for _, s := range append(append([]*string{}, a...), b...) {
+		if !seen[*s] {
+			seen[*s] = true
+			out = append(out, aws.String(*s))
+		}
+	}
+	return out
+}
+
+func difference(a, b []*string) []*string {
+	drop := make(map[string]bool)
+	for _, s := range b {
+		drop[*s] = true
+	}
+	var out []*string
+	for _, s := range a {
+		if !drop[*s] {
+			out = append(out, aws.String(*s))
+		}
+	}
+	return out
+}
+
+func parseNumber(s string) (*big.Rat, error) {
+	r, ok := new(big.Rat).SetString(s)
+	if !ok {
+		return nil, fmt.Errorf("A value provided cannot be converted into a number")
+	}
+	return r, nil
+}
+
+func formatNumber(r *big.Rat) string {
+	if r.IsInt() {
+		return r.Num().String()
+	}
+	s := strings.TrimRight(r.FloatString(38), "0")
+	return strings.TrimSuffix(s, ".")
+}
+
+func equal(a, b *dynamodb.AttributeValue) bool {
+	switch {
+	case a.S != nil && b.S != nil:
+		return *a.S == *b.S
+	case a.N != nil && b.N != nil:
+		cmp, ok := compare(a, b)
+		return ok && cmp == 0
+	case a.B != nil && b.B != nil:
+		return bytes.Equal(a.B, b.B)
+	case a.BOOL != nil && b.BOOL != nil:
+		return *a.BOOL == *b.BOOL
+	case a.NULL != nil && b.NULL != nil:
+		return true
+	}
+	return reflect.DeepEqual(a, b)
+}
+
+func compare(a, b *dynamodb.AttributeValue) (int, bool) {
+	switch {
+	case a.S != nil && b.S != nil:
+		return strings.Compare(*a.S, *b.S), true
+	case a.N != nil && b.N != nil:
+		x, err := parseNumber(*a.N)
+		if err != nil {
+			return 0, false
+		}
+		y, err := parseNumber(*b.N)
+		if err != nil {
+			return 0, false
+		}
+		return x.Cmp(y), true
+	case a.B != nil && b.B != nil:
+		return bytes.Compare(a.B, b.B), true
+	}
+	return 0, false
+}
+
+func copyItem(it item) item {
+	if it == nil {
+		return nil
+	}
+	out := make(item, len(it))
+	for k, v := range it {
+		out[k] = copyAttributeValue(v)
+	}
+	return out
+}
+
+func copyStrings(ss []*string) []*string {
+	if ss == nil {
+		return nil
+	}
+	out := make([]*string, len(ss))
+	for i, s := range ss {
+		out[i] = aws.String(aws.StringValue(s))
+	}
+	return out
+}
+
+func copyAttributeValue(v *dynamodb.AttributeValue) *dynamodb.AttributeValue {
+	if v == nil {
+		return nil
+	}
+	out := &dynamodb.AttributeValue{
+		SS: copyStrings(v.SS),
+		NS: copyStrings(v.NS),
+		M:  copyItem(v.M),
+	}
+	if v.S != nil {
+		out.S = aws.String(*v.S)
+	}
+	if v.N != nil {
+		out.N = aws.String(*v.N)
+	}
+	if v.B != nil {
+		out.B = append([]byte{}, v.B...)
+	}
+	if v.BOOL != nil {
+		out.BOOL = aws.Bool(*v.BOOL)
+	}
+	if v.NULL != nil {
+		out.NULL = aws.Bool(*v.NULL)
+	}
+	for _, b := range v.BS {
+		out.BS = append(out.BS, append([]byte{}, b...))
+	}
+	if v.L != nil {
+		out.L = make([]*dynamodb.AttributeValue, len(v.L))
+		for i, e := range v.L {
+			out.L[i] = copyAttributeValue(e)
+		}
+	}
+	return out
+}
@@ -17,9 +17,11 @@ limitations under the License.
 package dynamolock
 
 import (
+	"context"
 	"fmt"
 	"time"
 
+	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
 	"github.com/aws/aws-sdk-go/service/dynamodb"
 )
@@ -54,6 +56,13 @@ func (e *LockNotGrantedError) Unwrap() error {
 	return e.cause
 }
 
+func ctxLockNotGrantedError(ctx context.Context) error {
+	return &LockNotGrantedError{
+		msg:   "Didn't acquire lock because the context is done",
+		cause: ctx.Err(),
+	}
+}
+
 func isLockNotGrantedError(err error) bool {
 	_, ok := err.(*LockNotGrantedError)
 	return ok
@@ -67,7 +76,35 @@ func parseDynamoDBError(err error, msg string) error {
 				msg:   msg,
 				cause: aerr,
 			}
+		case dynamodb.ErrCodeTransactionCanceledException:
+			if transactionCanceledBy(aerr, cancellationReasonConditionalCheckFailed) {
+				return &LockNotGrantedError{
+					msg:   msg,
+					cause: aerr,
+				}
+			}
 		}
 	}
 	return err
 }
+
+// Cancellation reasons of DynamoDB transactions.
+const (
+	cancellationReasonConditionalCheckFailed = "ConditionalCheckFailed"
+	cancellationReasonTransactionConflict    = "TransactionConflict"
+)
+
+// transactionCanceledBy tells whether err is a canceled transaction in which
+// at least one of the items failed for the given reason.
+func transactionCanceledBy(err error, reason string) bool {
+	tce, ok := err.(*dynamodb.TransactionCanceledException)
+	if !ok {
+		return false
+	}
+	for _, r := range tce.CancellationReasons {
+		if aws.StringValue(r.Code) == reason {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// The fencing token of a lock is counted in an item of its own, next to the
+// lock item. Unlike the lock item, the counter item is never deleted: it
+// carries no lease and, on purpose, no expiry attribute, so neither
+// WithDeleteLockOnRelease nor DynamoDB time to live can bring the sequence back
+// to the start. As a consequence, every lock key ever acquired leaves a small
+// counter item behind. Every acquisition writes the lock item and the counter
+// item in one transaction, conditioned on the counter value known beforehand:
+// the one carried by the lock item, or the one read from the counter item when
+// there is no lock item.
+
+// fencingCounterKeyPrefix prefixes the partition key of the counter items.
+// Lock keys cannot start with it.
+const fencingCounterKeyPrefix = "dynamolock.fencing#"
+
+// ErrReservedKey indicates the lock key starts with the prefix this package
+// reserves for its own bookkeeping items.
+var ErrReservedKey = errors.New("lock key uses the prefix reserved by dynamolock: " + fencingCounterKeyPrefix)
+
+func checkKey(key string) error {
+	if strings.HasPrefix(key, fencingCounterKeyPrefix) {
+		return ErrReservedKey
+	}
+	return nil
+}
+
+var (
+	fencingCounterDoesntExistCondition = fmt.Sprintf("attribute_not_exists(%s)",
+		pkPathExpressionVariable)
+	fencingCounterIsTheSameCondition = fmt.Sprintf("attribute_exists(%s) AND %s = %s",
+		pkPathExpressionVariable, fencingTokenPathExpressionVariable, fencingTokenValueExpressionVariable)
+)
+
+// fencingCounter is the counter item of a lock as known before an acquisition.
+type fencingCounter struct {
+	key    string
+	value  int64
+	exists bool
+}
+
+// fencingCounterFor returns the counter of the lock. Lock items are written
+// along with their counter item and carry its value, so the counter item is
+// only read when there is no lock item to go by.
+func (c *Client) fencingCounterFor(ctx context.Context, key string, existingLock *Lock) (*fencingCounter, error) {
+	if existingLock != nil && existingLock.fencingToken > 0 {
+		return &fencingCounter{key: key, value: existingLock.fencingToken, exists: true}, nil
+	}
+	return c.readFencingCounter(ctx, key)
+}
+
+func (c *Client) readFencingCounter(ctx context.Context, key string) (*fencingCounter, error) {
+	res, err := c.readFromDynamoDB(ctx, fencingCounterKeyPrefix+key)
+	if err != nil {
+		return nil, err
+	}
+	fc := &fencingCounter{key: key}
+	if res.Item == nil {
+		return fc, nil
+	}
+	fc.exists = true
+	if r, ok := res.Item[attrFencingToken]; ok {
+		fc.value, err = strconv.ParseInt(aws.StringValue(r.N), 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("cannot parse fencing token counter: %s", err)
+		}
+	}
+	return fc, nil
+}
+
+// next returns the fencing token of the next acquisition.
+func (fc *fencingCounter) next() int64 {
+	return fc.value + 1
+}
+
+// putFencingCounter is the transaction item that advances the counter to the
+// given token, provided no one else advanced it since it was read.
+func (c *Client) putFencingCounter(fc *fencingCounter, fencingToken int64) *dynamodb.TransactWriteItem {
+	item := c.itemKeys(fencingCounterKeyPrefix + fc.key)
+	item[attrFencingToken] = &dynamodb.AttributeValue{N: aws.String(strconv.FormatInt(fencingToken, 10))}
+	names := map[string]*string{
+		pkPathExpressionVariable: aws.String(c.partitionKeyName),
+	}
+	var values map[string]*dynamodb.AttributeValue
+	condition := fencingCounterDoesntExistCondition
+	if fc.exists {
+		condition = fencingCounterIsTheSameCondition
+		names[fencingTokenPathExpressionVariable] = aws.String(attrFencingToken)
+		values = map[string]*dynamodb.AttributeValue{
+			fencingTokenValueExpressionVariable: {N: aws.String(strconv.FormatInt(fc.value, 10))},
+		}
+	}
+	return &dynamodb.TransactWriteItem{
+		Put: &dynamodb.Put{
+			Item:                      item,
+			TableName:                 aws.String(c.tableName),
+			ConditionExpression:       aws.String(condition),
+			ExpressionAttributeNames:  names,
+			ExpressionAttributeValues: values,
+		},
+	}
+}
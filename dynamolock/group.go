@@ -0,0 +1,418 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// maxTransactionItems is the maximum number of items DynamoDB accepts in a
+// single transaction.
+const maxTransactionItems = 25
+
+// maxGroupKeys is the maximum number of keys locked at once: the acquisition
+// writes both the lock item and the fencing token counter of each key.
+const maxGroupKeys = maxTransactionItems / 2
+
+// LockGroup is a set of locks acquired together by AcquireLocks. Its members
+// are heartbeated together, in a single transaction, so either all of them
+// are kept alive or the group is lost.
+type LockGroup struct {
+	client          *Client
+	locks           []*Lock
+	refreshPeriod   time.Duration
+	cancelHeartbeat context.CancelFunc
+}
+
+// Locks returns the members of the group, in the order their keys were given
+// to AcquireLocks.
+func (g *LockGroup) Locks() []*Lock {
+	if g == nil {
+		return nil
+	}
+	locks := make([]*Lock, len(g.locks))
+	copy(locks, g.locks)
+	return locks
+}
+
+// IsExpired returns whether any of the members of the group is expired or
+// released.
+func (g *LockGroup) IsExpired() bool {
+	if g == nil {
+		return true
+	}
+	for _, l := range g.locks {
+		if l.IsExpired() {
+			return true
+		}
+	}
+	return false
+}
+
+// Close releases all the members of the group.
+func (g *LockGroup) Close() error {
+	return g.CloseWithContext(context.Background())
+}
+
+// CloseWithContext releases all the members of the group. It tries to release
+// every member even if some of them fail, and returns the first error. The
+// given context is passed down to the underlying dynamoDB calls.
+func (g *LockGroup) CloseWithContext(ctx context.Context) error {
+	if g == nil {
+		return ErrCannotReleaseNullLock
+	}
+	if g.cancelHeartbeat != nil {
+		g.cancelHeartbeat()
+	}
+	var firstErr error
+	for _, l := range g.locks {
+		if err := g.client.releaseLock(ctx, l); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	return firstErr
+}
+
+// AcquireLocks holds the locks of all the given keys at once: they are written
+// in a single DynamoDB transaction, so either all of them are acquired or none
+// is. As no lock is ever held while waiting for the others, acquiring the same
+// keys in different orders cannot deadlock. The options apply to every
+// member of the group, except WithHeartbeatErrorHandler, which is called once
+// per failed group heartbeat.
+func (c *Client) AcquireLocks(keys []string, opts ...AcquireLockOption) (*LockGroup, error) {
+	return c.AcquireLocksWithContext(context.Background(), keys, opts...)
+}
+
+// AcquireLocksWithContext holds the locks of all the given keys at once. The
+// given context is passed down to the underlying dynamoDB calls and it also
+// interrupts the wait for the locks.
+func (c *Client) AcquireLocksWithContext(ctx context.Context, keys []string, opts ...AcquireLockOption) (_ *LockGroup, err error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("no keys to lock")
+	} else if len(keys) > maxGroupKeys {
+		return nil, fmt.Errorf("cannot lock more than %d keys at once", maxGroupKeys)
+	}
+	seen := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		if err := checkKey(key); err != nil {
+			return nil, err
+		}
+		if seen[key] {
+			return nil, fmt.Errorf("duplicated key: %s", key)
+		}
+		seen[key] = true
+	}
+	req := &acquireLockOptions{}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	// Hold the read lock when acquiring locks. This prevents us from
+	// acquiring a lock while the Client is being closed as we hold the
+	// write lock during close.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+	start := time.Now()
+	defer func() {
+		for _, key := range keys {
+			c.observeAcquisition(key, start, err)
+		}
+	}()
+
+	if err := c.checkAdditionalAttributes(req.additionalAttributes); err != nil {
+		return nil, err
+	}
+	members := make([]*getLockOptions, len(keys))
+	for i, key := range keys {
+		getLockOptions := newGetLockOptions(req, key, start)
+		members[i] = &getLockOptions
+	}
+	refreshPeriod := members[0].refreshPeriodDuration
+	for {
+		var g *LockGroup
+		g, err = c.storeLocks(ctx, members)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctxLockNotGrantedError(ctx)
+		} else if err != nil {
+			return nil, err
+		} else if g != nil {
+			g.refreshPeriod = refreshPeriod
+			c.startGroupHeartbeat(g, req.heartbeatErrorHandler)
+			return g, nil
+		}
+		c.logger.Println("Sleeping for a refresh period of ", refreshPeriod)
+		select {
+		case <-ctx.Done():
+			return nil, ctxLockNotGrantedError(ctx)
+		case <-time.After(refreshPeriod):
+		}
+	}
+}
+
+// storeLocks is the multi-key counterpart of storeLock: it writes all the lock
+// items in one transaction as soon as none of them is held by someone else. It
+// returns a nil group when it should be called again after a refresh period.
+func (c *Client) storeLocks(ctx context.Context, members []*getLockOptions) (*LockGroup, error) {
+	var (
+		transactItems []*dynamodb.TransactWriteItem
+		locks         []*Lock
+		held          []*getLockOptions
+	)
+	for _, getLockOptions := range members {
+		existingLock, err := c.getLockFromDynamoDB(ctx, *getLockOptions)
+		if err != nil {
+			return nil, err
+		}
+
+		var (
+			conditionalExpression     string
+			expressionAttributeNames  map[string]*string
+			expressionAttributeValues map[string]*dynamodb.AttributeValue
+		)
+		lockTryingToBeAcquired := getLockOptions.lockTryingToBeAcquired
+		switch {
+		case existingLock == nil || existingLock.isReleased:
+			conditionalExpression, expressionAttributeNames, expressionAttributeValues = c.newOrReleasedLockCondition(existingLock)
+		case lockTryingToBeAcquired != nil && lockTryingToBeAcquired.recordVersionNumber == existingLock.recordVersionNumber && lockTryingToBeAcquired.isExpired():
+			conditionalExpression, expressionAttributeNames, expressionAttributeValues = c.expiredLockCondition(existingLock)
+		default:
+			if getLockOptions.failIfLocked {
+				return nil, &LockNotGrantedError{msg: fmt.Sprintf("Didn't acquire locks because %s is locked and request is configured not to retry.", getLockOptions.partitionKeyName)}
+			}
+			if lockTryingToBeAcquired == nil || lockTryingToBeAcquired.recordVersionNumber != existingLock.recordVersionNumber {
+				getLockOptions.lockTryingToBeAcquired = existingLock
+			}
+			if !getLockOptions.alreadySleptOnceForOneLeasePeriod {
+				getLockOptions.alreadySleptOnceForOneLeasePeriod = true
+				getLockOptions.millisecondsToWait += existingLock.leaseDuration
+			}
+			held = append(held, getLockOptions)
+			continue
+		}
+
+		fencingCounter, err := c.fencingCounterFor(ctx, getLockOptions.partitionKeyName, existingLock)
+		if err != nil {
+			return nil, err
+		}
+		fencingToken := fencingCounter.next()
+		item, newLockData, recordVersionNumber := c.draftLockItem(getLockOptions, existingLock, fencingToken)
+		transactItems = append(transactItems, &dynamodb.TransactWriteItem{
+			Put: &dynamodb.Put{
+				Item:                      item,
+				TableName:                 aws.String(c.tableName),
+				ConditionExpression:       aws.String(conditionalExpression),
+				ExpressionAttributeNames:  expressionAttributeNames,
+				ExpressionAttributeValues: expressionAttributeValues,
+			},
+		}, c.putFencingCounter(fencingCounter, fencingToken))
+		locks = append(locks, &Lock{
+			client:               c,
+			partitionKey:         getLockOptions.partitionKeyName,
+			data:                 newLockData,
+			deleteLockOnRelease:  getLockOptions.deleteLockOnRelease,
+			ownerName:            c.ownerName,
+			leaseDuration:        c.leaseDuration,
+			recordVersionNumber:  recordVersionNumber,
+			fencingToken:         fencingToken,
+			additionalAttributes: getLockOptions.additionalAttributes,
+			sessionMonitor:       getLockOptions.sessionMonitor,
+		})
+	}
+
+	for _, getLockOptions := range held {
+		if t := time.Since(getLockOptions.start); t > getLockOptions.millisecondsToWait {
+			return nil, &LockNotGrantedError{
+				msg:   fmt.Sprintf("Didn't acquire locks after sleeping, %s is still locked", getLockOptions.partitionKeyName),
+				cause: &TimeoutError{Age: t},
+			}
+		}
+	}
+	if len(held) > 0 {
+		return nil, nil
+	}
+
+	lastUpdatedTime := time.Now()
+	for _, l := range locks {
+		c.logger.Println("Acquiring lock on ", c.partitionKeyName, "=", l.partitionKey, " as part of a group")
+		c.observer.AcquireAttempt(l.partitionKey)
+	}
+	_, err := c.dynamoDB.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		err = parseDynamoDBError(err, "cannot store lock items: lock already acquired by other client")
+		if isLockNotGrantedError(err) || transactionCanceledBy(err, cancellationReasonTransactionConflict) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	for _, l := range locks {
+		l.lookupTime = lastUpdatedTime
+		c.locks.Store(l.uniqueIdentifier(), l)
+		c.tryAddSessionMonitor(l.uniqueIdentifier(), l)
+	}
+	return &LockGroup{client: c, locks: locks}, nil
+}
+
+// startGroupHeartbeat spawns the goroutine that keeps the members of the
+// group alive. Releasing any of the members stops it.
+func (c *Client) startGroupHeartbeat(g *LockGroup, errorHandler func(error)) {
+	if c.heartbeatPeriod <= 0 {
+		return
+	}
+	for _, l := range g.locks {
+		l.semaphore.Lock()
+		defer l.semaphore.Unlock()
+		if l.isReleased {
+			return
+		}
+	}
+	ctx, cancel := context.WithCancel(c.heartbeatContext)
+	g.cancelHeartbeat = cancel
+	for _, l := range g.locks {
+		l.refreshPeriod = g.refreshPeriod
+		l.cancelHeartbeat = cancel
+	}
+	c.goHeartbeat(ctx, g, errorHandler)
+}
+
+func (g *LockGroup) heartbeatName() string {
+	keys := make([]string, len(g.locks))
+	for i, l := range g.locks {
+		keys[i] = l.partitionKey
+	}
+	return strings.Join(keys, ",")
+}
+
+func (g *LockGroup) timeUntilNextHeartbeat(heartbeatPeriod time.Duration) time.Duration {
+	next := g.locks[0].timeUntilNextHeartbeat(heartbeatPeriod)
+	for _, l := range g.locks[1:] {
+		if t := l.timeUntilNextHeartbeat(heartbeatPeriod); t < next {
+			next = t
+		}
+	}
+	return next
+}
+
+func (g *LockGroup) retryPeriod() time.Duration {
+	return g.refreshPeriod
+}
+
+func (g *LockGroup) isTracked() bool {
+	for _, l := range g.locks {
+		if !l.isTracked() {
+			return false
+		}
+	}
+	return true
+}
+
+func (g *LockGroup) sendHeartbeat(ctx context.Context) error {
+	return g.client.sendGroupHeartbeat(ctx, g)
+}
+
+// sendGroupHeartbeat refreshes all the members of the group in a single
+// transaction.
+func (c *Client) sendGroupHeartbeat(ctx context.Context, g *LockGroup) (err error) {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	defer func() {
+		for _, l := range g.locks {
+			c.observeHeartbeat(l.partitionKey, err)
+		}
+	}()
+	leaseDuration := c.leaseDuration
+
+	for _, l := range g.locks {
+		l.semaphore.Lock()
+		defer l.semaphore.Unlock()
+	}
+
+	now := time.Now()
+	transactItems := make([]*dynamodb.TransactWriteItem, len(g.locks))
+	rvns := make([]string, len(g.locks))
+	for i, l := range g.locks {
+		if l.isExpired() || l.isReleased {
+			c.untrackGroup(g)
+			return &LockNotGrantedError{msg: "cannot send heartbeat because lock group is not granted"}
+		}
+		rvns[i] = c.generateRecordVersionNumber()
+		expressionAttributeNames := map[string]*string{
+			pkPathExpressionVariable:                 aws.String(c.partitionKeyName),
+			leaseDurationPathValueExpressionVariable: aws.String(attrLeaseDuration),
+			rvnPathExpressionVariable:                aws.String(attrRecordVersionNumber),
+			ownerNamePathExpressionVariable:          aws.String(attrOwnerName),
+			lastUpdatedPathExpressionVariable:        aws.String(attrLastUpdated),
+		}
+		expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+			rvnValueExpressionVariable:           {S: aws.String(l.recordVersionNumber)},
+			ownerNameValueExpressionVariable:     {S: aws.String(l.ownerName)},
+			newRvnValueExpressionVariable:        {S: aws.String(rvns[i])},
+			leaseDurationValueExpressionVariable: {S: aws.String(leaseDuration.String())},
+			lastUpdatedValueExpressionVariable:   lastUpdatedAttributeValue(now),
+		}
+		updateExpression := c.withExpiry(updateLeaseDurationAndRvn, now, expressionAttributeNames, expressionAttributeValues)
+		transactItems[i] = &dynamodb.TransactWriteItem{
+			Update: &dynamodb.Update{
+				TableName:                 aws.String(c.tableName),
+				Key:                       c.getItemKeys(l),
+				ConditionExpression:       aws.String(pkExistsAndOwnerNameSameAndRvnSameCondition),
+				UpdateExpression:          aws.String(updateExpression),
+				ExpressionAttributeNames:  expressionAttributeNames,
+				ExpressionAttributeValues: expressionAttributeValues,
+			},
+		}
+	}
+
+	_, err = c.dynamoDB.TransactWriteItemsWithContext(ctx, &dynamodb.TransactWriteItemsInput{
+		TransactItems: transactItems,
+	})
+	if err != nil {
+		err := parseDynamoDBError(err, "lock group was lost, stopping heartbeats")
+		if isLockNotGrantedError(err) {
+			c.untrackGroup(g)
+		}
+		return err
+	}
+	for i, l := range g.locks {
+		l.updateRVN(rvns[i], now, leaseDuration)
+	}
+	return nil
+}
+
+// untrackGroup stops tracking the members of a group that is lost.
+func (c *Client) untrackGroup(g *LockGroup) {
+	for _, l := range g.locks {
+		if c.isTracked(l) {
+			c.locks.Delete(l.uniqueIdentifier())
+		}
+	}
+}
@@ -0,0 +1,141 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+)
+
+func TestAcquireLocks(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	c1 := newRWClient(t, svc, "AcquireLocks#1")
+	defer c1.Close()
+	c2 := newRWClient(t, svc, "AcquireLocks#2")
+	defer c2.Close()
+
+	g, err := c1.AcquireLocks([]string{"group-a", "group-b"}, dynamolock.WithData([]byte("group")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if locks := g.Locks(); len(locks) != 2 || string(locks[0].Data()) != "group" || string(locks[1].Data()) != "group" {
+		t.Fatal("unexpected group members:", locks)
+	}
+	if _, err := c2.AcquireLocks([]string{"group-c", "group-b"}, dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("group-b is held, the group should not be granted:", err)
+	}
+	c, err := c2.AcquireLock("group-c", dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("group-c should not have been acquired by the failed group:", err)
+	}
+	if _, err := c2.ReleaseLock(c); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if g.IsExpired() {
+		t.Fatal("group heartbeats should have kept the members alive")
+	}
+	if _, err := c2.AcquireLock("group-a", dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("group-a should still be held:", err)
+	}
+	if err := g.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsExpired() {
+		t.Fatal("closed group should be expired")
+	}
+
+	g2, err := c2.AcquireLocks([]string{"group-b", "group-c", "group-a"}, dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g2.Close()
+	if got := g2.Locks()[2].FencingToken(); got != 2 {
+		t.Fatal("unexpected fencing token for group-a:", got)
+	}
+}
+
+func TestAcquireLocksWaits(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	c1 := newRWClient(t, svc, "AcquireLocksWaits#1")
+	defer c1.Close()
+	c2 := newRWClient(t, svc, "AcquireLocksWaits#2")
+	defer c2.Close()
+
+	held, err := c1.AcquireLock("wait-x")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := make(chan *dynamolock.LockGroup, 1)
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		g, err := c2.AcquireLocksWithContext(ctx, []string{"wait-x", "wait-y"},
+			dynamolock.WithRefreshPeriod(100*time.Millisecond))
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- g
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	y, err := c1.AcquireLock("wait-y", dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("wait-y must stay free while wait-x is held:", err)
+	}
+	if _, err := c1.ReleaseLock(y); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.ReleaseLock(held); err != nil {
+		t.Fatal(err)
+	}
+	g := <-acquired
+	if g == nil {
+		t.Fatal("group not acquired")
+	}
+	defer g.Close()
+
+	if _, err := c2.ReleaseLock(g.Locks()[1]); err != nil {
+		t.Fatal(err)
+	}
+	if !g.IsExpired() {
+		t.Fatal("group with a released member should be expired")
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	if _, err := c1.AcquireLockWithContext(ctx, "wait-x"); err != nil {
+		t.Fatal("releasing a member should stop the group heartbeats:", err)
+	}
+}
+
+func TestAcquireLocksValidation(t *testing.T) {
+	t.Parallel()
+	c := newRWClient(t, newDynamoDB(t), "AcquireLocksValidation#1")
+	defer c.Close()
+	if _, err := c.AcquireLocks(nil); err == nil {
+		t.Fatal("expected error for empty group")
+	}
+	if _, err := c.AcquireLocks([]string{"k", "k"}); err == nil {
+		t.Fatal("expected error for duplicated key")
+	}
+}
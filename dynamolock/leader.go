@@ -0,0 +1,220 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// LeadershipEvent reports a change in the leadership of a LeaderElector.
+type LeadershipEvent int
+
+// Leadership events.
+const (
+	// BecameLeader is emitted when the elector acquires the leader lock.
+	BecameLeader LeadershipEvent = iota + 1
+	// LostLeadership is emitted when the elector stops being the leader,
+	// either because the lock was lost, the campaign ended or the elector
+	// resigned.
+	LostLeadership
+)
+
+func (e LeadershipEvent) String() string {
+	switch e {
+	case BecameLeader:
+		return "became leader"
+	case LostLeadership:
+		return "lost leadership"
+	}
+	return "unknown leadership event"
+}
+
+// Errors related to leader election.
+var (
+	ErrAlreadyCampaigning = errors.New("leader elector is already campaigning")
+	ErrNoLeader           = errors.New("no leader elected")
+)
+
+// LeaderElector campaigns to hold the lock of a key for as long as possible,
+// so that a single instance among many is the leader at any given time.
+type LeaderElector struct {
+	client *Client
+	key    string
+	opts   []AcquireLockOption
+
+	mu          sync.Mutex
+	isLeader    bool
+	campaigning bool
+	resign      context.CancelFunc
+	resigned    bool
+	events      chan LeadershipEvent
+}
+
+// NewLeaderElector creates a leader elector for the given key. The options are
+// used every time the elector tries to acquire the lock; use WithData to
+// publish information about the leader to the followers, it replaces the data
+// left by the previous leader. Unless
+// WithSessionMonitor is given, leadership is abandoned as soon as the lock is
+// a quarter of the lease duration away from expiring.
+func (c *Client) NewLeaderElector(key string, opts ...AcquireLockOption) *LeaderElector {
+	return &LeaderElector{
+		client: c,
+		key:    key,
+		opts: append([]AcquireLockOption{
+			ReplaceData(),
+			WithSessionMonitor(c.leaseDuration*3/4, nil),
+		}, opts...),
+	}
+}
+
+// Campaign competes for the leadership until the context is done or the
+// elector resigns. While leader, the lock is heartbeated; when the lock is lost
+// the elector immediately campaigns again, while failed attempts are retried
+// after the refresh period (see WithRefreshPeriod). It returns nil after
+// Resign, and the context error when the context is done.
+func (e *LeaderElector) Campaign(ctx context.Context) error {
+	e.mu.Lock()
+	if e.campaigning {
+		e.mu.Unlock()
+		return ErrAlreadyCampaigning
+	}
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	e.campaigning = true
+	e.resigned = false
+	e.resign = cancel
+	e.mu.Unlock()
+	defer func() {
+		e.mu.Lock()
+		e.campaigning = false
+		e.mu.Unlock()
+	}()
+
+	for {
+		err := e.client.Do(ctx, e.key, e.lead, e.opts...)
+		if ctx.Err() != nil {
+			e.mu.Lock()
+			resigned := e.resigned
+			e.mu.Unlock()
+			if resigned {
+				return nil
+			}
+			return ctx.Err()
+		} else if err == ErrClientClosed {
+			return err
+		} else if err != nil {
+			if !isLockNotGrantedError(err) {
+				e.client.logger.Println("error campaigning for", e.key, ":", err)
+			}
+			// With FailIfLocked, Do gives up right away while someone
+			// else is the leader.
+			select {
+			case <-ctx.Done():
+			case <-time.After(e.retryPeriod()):
+			}
+		}
+	}
+}
+
+// retryPeriod is how long the elector waits after a failed attempt: the
+// refresh period of the options, if any, or defaultBuffer.
+func (e *LeaderElector) retryPeriod() time.Duration {
+	req := &acquireLockOptions{}
+	for _, opt := range e.opts {
+		opt(req)
+	}
+	if req.refreshPeriod > 0 {
+		return req.refreshPeriod
+	}
+	return defaultBuffer
+}
+
+// lead holds the leadership until ctx is canceled by Do, which happens when
+// the lock is lost, the campaign ends or the elector resigns.
+func (e *LeaderElector) lead(ctx context.Context, l *Lock) error {
+	e.setLeader(true)
+	e.emit(BecameLeader)
+	<-ctx.Done()
+	e.setLeader(false)
+	e.emit(LostLeadership)
+	return nil
+}
+
+func (e *LeaderElector) setLeader(isLeader bool) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.isLeader = isLeader
+}
+
+func (e *LeaderElector) emit(ev LeadershipEvent) {
+	e.mu.Lock()
+	events := e.events
+	e.mu.Unlock()
+	if events != nil {
+		events <- ev
+	}
+}
+
+// IsLeader tells whether the elector currently holds the leadership.
+func (e *LeaderElector) IsLeader() bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	return e.isLeader
+}
+
+// Events returns the channel on which leadership changes are delivered. Once
+// Events is called, the campaign waits for each event to be received, so the
+// channel must be drained.
+func (e *LeaderElector) Events() <-chan LeadershipEvent {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.events == nil {
+		e.events = make(chan LeadershipEvent, 1)
+	}
+	return e.events
+}
+
+// Resign stops the campaign and releases the leadership if held.
+func (e *LeaderElector) Resign() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	if e.campaigning && e.resign != nil {
+		e.resigned = true
+		e.resign()
+	}
+}
+
+// Leader returns the lock of the current leader, as stored in DynamoDB. Its
+// OwnerName and Data identify the leader. If no one is leading, it returns
+// ErrNoLeader. Note that a leader that crashed is reported until another
+// elector takes over its expired lock.
+func (e *LeaderElector) Leader(ctx context.Context) (*Lock, error) {
+	l, err := e.client.GetWithContext(ctx, e.key)
+	if err != nil {
+		return nil, err
+	}
+	l.semaphore.Lock()
+	noLeader := l.ownerName == "" || l.isReleased
+	l.semaphore.Unlock()
+	if noLeader {
+		return nil, ErrNoLeader
+	}
+	return l, nil
+}
@@ -0,0 +1,168 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func expectEvent(t *testing.T, events <-chan dynamolock.LeadershipEvent, expected dynamolock.LeadershipEvent) {
+	t.Helper()
+	select {
+	case ev := <-events:
+		if ev != expected {
+			t.Fatalf("expected %v event, got: %v", expected, ev)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatalf("timed out waiting for %v event", expected)
+	}
+}
+
+func TestLeaderElector(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	c1 := newRWClient(t, svc, "LeaderElector#1")
+	defer c1.Close()
+	c2 := newRWClient(t, svc, "LeaderElector#2")
+	defer c2.Close()
+
+	const key = "leaderElector"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	e1 := c1.NewLeaderElector(key, dynamolock.WithData([]byte("leader#1")))
+	events1 := e1.Events()
+	campaign1 := make(chan error, 1)
+	go func() { campaign1 <- e1.Campaign(ctx) }()
+	expectEvent(t, events1, dynamolock.BecameLeader)
+	if !e1.IsLeader() {
+		t.Fatal("first elector should be the leader")
+	}
+
+	e2 := c2.NewLeaderElector(key,
+		dynamolock.WithData([]byte("leader#2")),
+		dynamolock.WithRefreshPeriod(100*time.Millisecond))
+	events2 := e2.Events()
+	campaign2 := make(chan error, 1)
+	go func() { campaign2 <- e2.Campaign(ctx) }()
+	time.Sleep(1500 * time.Millisecond)
+	if e2.IsLeader() {
+		t.Fatal("second elector must not be the leader")
+	}
+	if err := e2.Campaign(ctx); err != dynamolock.ErrAlreadyCampaigning {
+		t.Fatal("expected already campaigning error:", err)
+	}
+	leader, err := e2.Leader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader.OwnerName() != "LeaderElector#1" || string(leader.Data()) != "leader#1" {
+		t.Fatal("unexpected leader:", leader.OwnerName(), string(leader.Data()))
+	}
+
+	t.Log("resigning first elector")
+	e1.Resign()
+	expectEvent(t, events1, dynamolock.LostLeadership)
+	if err := <-campaign1; err != nil {
+		t.Fatal("resignation must end the campaign without errors:", err)
+	}
+	if e1.IsLeader() {
+		t.Fatal("first elector must not be the leader after resigning")
+	}
+	expectEvent(t, events2, dynamolock.BecameLeader)
+	leader, err = e1.Leader(ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if leader.OwnerName() != "LeaderElector#2" || string(leader.Data()) != "leader#2" {
+		t.Fatal("unexpected leader:", leader.OwnerName(), string(leader.Data()))
+	}
+
+	cancel()
+	expectEvent(t, events2, dynamolock.LostLeadership)
+	if err := <-campaign2; err != context.Canceled {
+		t.Fatal("expected context error:", err)
+	}
+	if _, err := e1.Leader(context.Background()); err != dynamolock.ErrNoLeader {
+		t.Fatal("expected no leader:", err)
+	}
+}
+
+func TestLeaderElectorFailIfLocked(t *testing.T) {
+	t.Parallel()
+	svc := &countingDynamoDB{DynamoDBAPI: newDynamoDB(t)}
+	c1 := newRWClient(t, svc, "LeaderElectorFailIfLocked#1")
+	defer c1.Close()
+	c2 := newRWClient(t, svc, "LeaderElectorFailIfLocked#2")
+	defer c2.Close()
+
+	const key = "leaderElectorFailIfLocked"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e1 := c1.NewLeaderElector(key)
+	events1 := e1.Events()
+	go e1.Campaign(ctx)
+	expectEvent(t, events1, dynamolock.BecameLeader)
+
+	e2 := c2.NewLeaderElector(key,
+		dynamolock.FailIfLocked(),
+		dynamolock.WithRefreshPeriod(500*time.Millisecond))
+	go e2.Campaign(ctx)
+	gets := svc.gets()
+	time.Sleep(time.Second)
+	if got := svc.gets() - gets; got > 10 {
+		t.Fatal("follower must wait between attempts, reads:", got)
+	}
+	if e2.IsLeader() {
+		t.Fatal("second elector must not be the leader")
+	}
+}
+
+func TestLeaderElectorLostLock(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	c := newRWClient(t, svc, "LeaderElectorLostLock#1")
+	defer c.Close()
+
+	const key = "leaderElectorLostLock"
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	e := c.NewLeaderElector(key)
+	events := e.Events()
+	go e.Campaign(ctx)
+	expectEvent(t, events, dynamolock.BecameLeader)
+
+	_, err := svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String(key)},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectEvent(t, events, dynamolock.LostLeadership)
+	expectEvent(t, events, dynamolock.BecameLeader)
+	e.Resign()
+	expectEvent(t, events, dynamolock.LostLeadership)
+}
@@ -0,0 +1,389 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// Locks that can be held by more than one owner at a time keep one lease per
+// owner in the same lock item. Each lease is a map attribute carrying the
+// owner name, the lease duration and a record version number that changes on
+// every heartbeat. Abandoned leases are detected with the same logic used for
+// locks: if the record version number does not change for a lease duration,
+// the lease is considered expired and may be removed by anyone.
+
+const (
+	leasePathExpressionVariable  = "#e"
+	leaseValueExpressionVariable = ":e"
+)
+
+var (
+	claimLeaseCondition = fmt.Sprintf("attribute_not_exists(%s)", leasePathExpressionVariable)
+
+	leaseRvnIsTheSameCondition = fmt.Sprintf("%s.%s = %s",
+		leasePathExpressionVariable, rvnPathExpressionVariable, rvnValueExpressionVariable)
+
+	updateLeaseDurationAndRvnOfLease = fmt.Sprintf("SET %s.%s = %s, %s.%s = %s",
+		leasePathExpressionVariable, leaseDurationPathValueExpressionVariable, leaseDurationValueExpressionVariable,
+		leasePathExpressionVariable, rvnPathExpressionVariable, newRvnValueExpressionVariable)
+)
+
+// lease is the share of a lock item held by this client.
+type lease struct {
+	semaphore sync.Mutex
+
+	client       *Client
+	partitionKey string
+	attr         string
+
+	ownerName       string
+	isReleased      bool
+	refreshPeriod   time.Duration
+	cancelHeartbeat context.CancelFunc
+
+	lookupTime          time.Time
+	recordVersionNumber string
+	leaseDuration       time.Duration
+}
+
+func (l *lease) uniqueIdentifier() string {
+	return l.partitionKey + "/" + l.attr
+}
+
+func (l *lease) isExpired() bool {
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	if l.isReleased {
+		return true
+	}
+	return time.Since(l.lookupTime) > l.leaseDuration
+}
+
+func (l *lease) heartbeatName() string {
+	return l.uniqueIdentifier()
+}
+
+func (l *lease) timeUntilNextHeartbeat(heartbeatPeriod time.Duration) time.Duration {
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	if half := l.leaseDuration / 2; half > 0 && heartbeatPeriod > half {
+		heartbeatPeriod = half
+	}
+	return time.Until(l.lookupTime.Add(heartbeatPeriod))
+}
+
+func (l *lease) retryPeriod() time.Duration {
+	return l.refreshPeriod
+}
+
+func (l *lease) isTracked() bool {
+	v, ok := l.client.leases.Load(l.uniqueIdentifier())
+	return ok && v.(*lease) == l
+}
+
+func (l *lease) sendHeartbeat(ctx context.Context) error {
+	return l.client.sendLeaseHeartbeat(ctx, l)
+}
+
+// leaseEntry is a lease as read from the lock item.
+type leaseEntry struct {
+	attr                string
+	ownerName           string
+	recordVersionNumber string
+	leaseDuration       time.Duration
+}
+
+func parseLeaseEntry(attr string, v *dynamodb.AttributeValue) (leaseEntry, bool) {
+	if v == nil || v.M == nil {
+		return leaseEntry{}, false
+	}
+	leaseDuration, err := time.ParseDuration(aws.StringValue(v.M[attrLeaseDuration].S))
+	if err != nil {
+		return leaseEntry{}, false
+	}
+	return leaseEntry{
+		attr:                attr,
+		ownerName:           aws.StringValue(v.M[attrOwnerName].S),
+		recordVersionNumber: aws.StringValue(v.M[attrRecordVersionNumber].S),
+		leaseDuration:       leaseDuration,
+	}, true
+}
+
+// leaseWatcher remembers since when each lease has been seen with its current
+// record version number.
+type leaseWatcher map[string]observedLease
+
+type observedLease struct {
+	recordVersionNumber string
+	since               time.Time
+}
+
+func (w leaseWatcher) isExpired(e leaseEntry) bool {
+	seen, ok := w[e.attr]
+	if !ok || seen.recordVersionNumber != e.recordVersionNumber {
+		w[e.attr] = observedLease{recordVersionNumber: e.recordVersionNumber, since: time.Now()}
+		return false
+	}
+	return time.Since(seen.since) > e.leaseDuration
+}
+
+// leaseAcquisition paces the attempts to acquire a lease with the same rules
+// as AcquireLock: attempts are a refresh period apart, and the caller gives up
+// after waiting for one lease duration of the current holder plus the
+// additional time to wait for the lock.
+type leaseAcquisition struct {
+	key                               string
+	failIfLocked                      bool
+	start                             time.Time
+	refreshPeriod                     time.Duration
+	timeToWait                        time.Duration
+	alreadySleptOnceForOneLeasePeriod bool
+	watcher                           leaseWatcher
+}
+
+func newLeaseAcquisition(opt *acquireLockOptions) *leaseAcquisition {
+	a := &leaseAcquisition{
+		key:           opt.partitionKey,
+		failIfLocked:  opt.failIfLocked,
+		start:         time.Now(),
+		refreshPeriod: defaultBuffer,
+		timeToWait:    defaultBuffer,
+		watcher:       make(leaseWatcher),
+	}
+	if opt.refreshPeriod > 0 {
+		a.refreshPeriod = opt.refreshPeriod
+	}
+	if opt.additionalTimeToWaitForLock > 0 {
+		a.timeToWait = opt.additionalTimeToWaitForLock
+	}
+	return a
+}
+
+// wait sleeps for a refresh period because the acquisition is blocked by the
+// given lease, or by a concurrent acquisition when holder is nil.
+func (a *leaseAcquisition) wait(ctx context.Context, holder *leaseEntry) error {
+	if a.failIfLocked {
+		return &LockNotGrantedError{msg: "Didn't acquire lock because it is locked and request is configured not to retry."}
+	}
+	if holder != nil && !a.alreadySleptOnceForOneLeasePeriod {
+		a.alreadySleptOnceForOneLeasePeriod = true
+		a.timeToWait += holder.leaseDuration
+	}
+	if t := time.Since(a.start); t > a.timeToWait {
+		return &LockNotGrantedError{
+			msg:   "Didn't acquire lock after sleeping",
+			cause: &TimeoutError{Age: t},
+		}
+	}
+	select {
+	case <-ctx.Done():
+		return ctxLockNotGrantedError(ctx)
+	case <-time.After(a.refreshPeriod):
+		return nil
+	}
+}
+
+func (c *Client) readLeases(ctx context.Context, key string) (map[string]*dynamodb.AttributeValue, error) {
+	res, err := c.readFromDynamoDB(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	return res.Item, nil
+}
+
+// claimLease stores a new lease in attribute attr of the lock item, as long as
+// the attribute is free and the given additional condition holds.
+func (c *Client) claimLease(ctx context.Context, key, attr, condition string, names map[string]*string) (*lease, error) {
+	rvn := c.generateRecordVersionNumber()
+	expressionAttributeNames := map[string]*string{
+		leasePathExpressionVariable: aws.String(attr),
+	}
+	for k, v := range names {
+		expressionAttributeNames[k] = v
+	}
+	conditionalExpression := claimLeaseCondition
+	if condition != "" {
+		conditionalExpression += " AND " + condition
+	}
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		leaseValueExpressionVariable: {M: map[string]*dynamodb.AttributeValue{
+			attrOwnerName:           {S: aws.String(c.ownerName)},
+			attrLeaseDuration:       {S: aws.String(c.leaseDuration.String())},
+			attrRecordVersionNumber: {S: aws.String(rvn)},
+		}},
+	}
+	lastUpdatedTime := time.Now()
+	updateExpression := c.withExpiry(fmt.Sprintf("SET %s = %s", leasePathExpressionVariable, leaseValueExpressionVariable),
+		lastUpdatedTime, expressionAttributeNames, expressionAttributeValues)
+	c.observer.AcquireAttempt(key)
+	_, err := c.dynamoDB.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.tableName),
+		Key:                       c.itemKeys(key),
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String(conditionalExpression),
+		ExpressionAttributeNames:  expressionAttributeNames,
+		ExpressionAttributeValues: expressionAttributeValues,
+	})
+	if err != nil {
+		return nil, parseDynamoDBError(err, "cannot store lease: already acquired by other client")
+	}
+	l := &lease{
+		client:              c,
+		partitionKey:        key,
+		attr:                attr,
+		ownerName:           c.ownerName,
+		lookupTime:          lastUpdatedTime,
+		recordVersionNumber: rvn,
+		leaseDuration:       c.leaseDuration,
+	}
+	c.leases.Store(l.uniqueIdentifier(), l)
+	return l, nil
+}
+
+// expireLease removes a lease that stopped being heartbeated. It reports
+// whether the lease was indeed removed; it is not when its owner sent a
+// heartbeat in the meantime.
+func (c *Client) expireLease(ctx context.Context, key string, e leaseEntry) (bool, error) {
+	c.logger.Println("Removing expired lease", e.attr, "of", e.ownerName, "from", key)
+	_, err := c.dynamoDB.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(c.tableName),
+		Key:                 c.itemKeys(key),
+		UpdateExpression:    aws.String(fmt.Sprintf("REMOVE %s", leasePathExpressionVariable)),
+		ConditionExpression: aws.String(leaseRvnIsTheSameCondition),
+		ExpressionAttributeNames: map[string]*string{
+			leasePathExpressionVariable: aws.String(e.attr),
+			rvnPathExpressionVariable:   aws.String(attrRecordVersionNumber),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			rvnValueExpressionVariable: {S: aws.String(e.recordVersionNumber)},
+		},
+	})
+	if err != nil {
+		err = parseDynamoDBError(err, "lease was renewed")
+		if isLockNotGrantedError(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (c *Client) sendLeaseHeartbeat(ctx context.Context, l *lease) (err error) {
+	if c.isClosed() {
+		return ErrClientClosed
+	}
+	defer func() {
+		c.observeHeartbeat(l.partitionKey, err)
+	}()
+	leaseDuration := c.leaseDuration
+
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+
+	if l.isReleased || time.Since(l.lookupTime) > l.leaseDuration {
+		c.leases.Delete(l.uniqueIdentifier())
+		return &LockNotGrantedError{msg: "cannot send heartbeat because lease is not granted"}
+	}
+
+	rvn := c.generateRecordVersionNumber()
+	lastUpdateOfLock := time.Now()
+	expressionAttributeNames := map[string]*string{
+		leasePathExpressionVariable:              aws.String(l.attr),
+		leaseDurationPathValueExpressionVariable: aws.String(attrLeaseDuration),
+		rvnPathExpressionVariable:                aws.String(attrRecordVersionNumber),
+	}
+	expressionAttributeValues := map[string]*dynamodb.AttributeValue{
+		rvnValueExpressionVariable:           {S: aws.String(l.recordVersionNumber)},
+		newRvnValueExpressionVariable:        {S: aws.String(rvn)},
+		leaseDurationValueExpressionVariable: {S: aws.String(leaseDuration.String())},
+	}
+	updateExpression := c.withExpiry(updateLeaseDurationAndRvnOfLease,
+		lastUpdateOfLock, expressionAttributeNames, expressionAttributeValues)
+	_, err = c.dynamoDB.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:                 aws.String(c.tableName),
+		Key:                       c.itemKeys(l.partitionKey),
+		UpdateExpression:          aws.String(updateExpression),
+		ConditionExpression:       aws.String(leaseRvnIsTheSameCondition),
+		ExpressionAttributeNames:  expressionAttributeNames,
+		ExpressionAttributeValues: expressionAttributeValues,
+	})
+	if err != nil {
+		err := parseDynamoDBError(err, "lease was lost, stopping heartbeats")
+		if isLockNotGrantedError(err) {
+			l.isReleased = true
+			c.leases.Delete(l.uniqueIdentifier())
+		}
+		return err
+	}
+	l.recordVersionNumber = rvn
+	l.lookupTime = lastUpdateOfLock
+	l.leaseDuration = leaseDuration
+	return nil
+}
+
+func (c *Client) startLeaseHeartbeat(l *lease, refreshPeriod time.Duration, errorHandler func(error)) {
+	if c.heartbeatPeriod <= 0 {
+		return
+	}
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	if l.isReleased {
+		return
+	}
+	ctx, cancel := context.WithCancel(c.heartbeatContext)
+	l.refreshPeriod = refreshPeriod
+	l.cancelHeartbeat = cancel
+	c.goHeartbeat(ctx, l, errorHandler)
+}
+
+func (c *Client) releaseLease(ctx context.Context, l *lease) (err error) {
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	if l.isReleased {
+		return ErrLockAlreadyReleased
+	}
+	defer func() {
+		c.observer.Release(l.partitionKey, err)
+	}()
+	l.isReleased = true
+	if l.cancelHeartbeat != nil {
+		l.cancelHeartbeat()
+	}
+	c.leases.Delete(l.uniqueIdentifier())
+
+	_, err = c.dynamoDB.UpdateItemWithContext(ctx, &dynamodb.UpdateItemInput{
+		TableName:           aws.String(c.tableName),
+		Key:                 c.itemKeys(l.partitionKey),
+		UpdateExpression:    aws.String(fmt.Sprintf("REMOVE %s", leasePathExpressionVariable)),
+		ConditionExpression: aws.String(leaseRvnIsTheSameCondition),
+		ExpressionAttributeNames: map[string]*string{
+			leasePathExpressionVariable: aws.String(l.attr),
+			rvnPathExpressionVariable:   aws.String(attrRecordVersionNumber),
+		},
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			rvnValueExpressionVariable: {S: aws.String(l.recordVersionNumber)},
+		},
+	})
+	return parseDynamoDBError(err, "lease was lost before release")
+}
@@ -0,0 +1,131 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+// LockInfo describes a lock item as found in the lock table.
+type LockInfo struct {
+	Key                  string
+	OwnerName            string
+	Data                 []byte
+	LeaseDuration        time.Duration
+	FencingToken         int64
+	AdditionalAttributes map[string]*dynamodb.AttributeValue
+
+	// LastUpdated is the time of the last acquisition, heartbeat or
+	// release of the lock, according to the clock of the client that
+	// performed it. It is zero for items written by older versions of
+	// this package.
+	LastUpdated time.Time
+
+	// IsReleased tells whether the lock was released without being
+	// deleted.
+	IsReleased bool
+
+	// AppearsExpired tells whether the lock is released or was last
+	// updated more than a lease duration ago. As it compares clocks of
+	// different machines, it is meant for observability only; lock
+	// acquisition does not depend on it.
+	AppearsExpired bool
+}
+
+// ListFilter selects which locks are returned by List.
+type ListFilter func(*LockInfo) bool
+
+// List scans the whole lock table and returns the locks accepted by filter, or
+// all of them if filter is nil. Items of shared locks and semaphores are
+// skipped, and so are the locks of other sort key values when the client uses
+// a sort key.
+func (c *Client) List(ctx context.Context, filter ListFilter) ([]*LockInfo, error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	var (
+		locks             []*LockInfo
+		exclusiveStartKey map[string]*dynamodb.AttributeValue
+	)
+	for {
+		input := &dynamodb.ScanInput{
+			TableName:         aws.String(c.tableName),
+			ConsistentRead:    aws.Bool(true),
+			ExclusiveStartKey: exclusiveStartKey,
+		}
+		if c.sortKeyName != "" {
+			input.FilterExpression = aws.String(sortKeyIsTheSameCondition)
+			input.ExpressionAttributeNames = map[string]*string{
+				skPathExpressionVariable: aws.String(c.sortKeyName),
+			}
+			input.ExpressionAttributeValues = map[string]*dynamodb.AttributeValue{
+				skValueExpressionVariable: {S: aws.String(c.sortKey)},
+			}
+		}
+		res, err := c.dynamoDB.ScanWithContext(ctx, input)
+		if err != nil {
+			return nil, err
+		}
+		for _, item := range res.Items {
+			if _, ok := item[attrOwnerName]; !ok {
+				continue
+			}
+			key := aws.StringValue(item[c.partitionKeyName].S)
+			l, err := c.createLockItem(getLockOptions{partitionKeyName: key}, item)
+			if err != nil {
+				return nil, err
+			}
+			info := l.Info()
+			if filter == nil || filter(info) {
+				locks = append(locks, info)
+			}
+		}
+		if len(res.LastEvaluatedKey) == 0 {
+			return locks, nil
+		}
+		exclusiveStartKey = res.LastEvaluatedKey
+	}
+}
+
+// Info describes the lock the same way List does. Combined with Get, it
+// inspects a single lock without scanning the table.
+func (l *Lock) Info() *LockInfo {
+	if l == nil {
+		return nil
+	}
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	expired := l.isReleased
+	if !l.lastUpdated.IsZero() && time.Since(l.lastUpdated) > l.leaseDuration {
+		expired = true
+	}
+	return &LockInfo{
+		Key:                  l.partitionKey,
+		OwnerName:            l.ownerName,
+		Data:                 l.data,
+		LeaseDuration:        l.leaseDuration,
+		FencingToken:         l.fencingToken,
+		AdditionalAttributes: l.additionalAttributes,
+		LastUpdated:          l.lastUpdated,
+		IsReleased:           l.isReleased,
+		AppearsExpired:       expired,
+	}
+}
@@ -0,0 +1,129 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"context"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+// pagingDynamoDB forces scans to return one item per page.
+type pagingDynamoDB struct {
+	dynamodbiface.DynamoDBAPI
+	pages int
+}
+
+func (p *pagingDynamoDB) ScanWithContext(ctx aws.Context, input *dynamodb.ScanInput, opts ...request.Option) (*dynamodb.ScanOutput, error) {
+	p.pages++
+	input.Limit = aws.Int64(1)
+	return p.DynamoDBAPI.ScanWithContext(ctx, input, opts...)
+}
+
+func TestList(t *testing.T) {
+	t.Parallel()
+	svc := &pagingDynamoDB{DynamoDBAPI: newDynamoDB(t)}
+	c1 := newRWClient(t, svc, "List#1", dynamolock.DisableHeartbeat())
+	defer c1.Close()
+	c2 := newRWClient(t, svc, "List#2")
+	defer c2.Close()
+
+	if _, err := c1.AcquireLock("list-expired", dynamolock.WithData([]byte("expired"))); err != nil {
+		t.Fatal(err)
+	}
+	released, err := c1.AcquireLock("list-released")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c1.ReleaseLock(released); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c2.AcquireLock("list-held", dynamolock.WithData([]byte("held"))); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c2.AcquireSharedLock("list-shared"); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+
+	ctx := context.Background()
+	locks, err := c1.List(ctx, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Slice(locks, func(i, j int) bool { return locks[i].Key < locks[j].Key })
+	var keys []string
+	for _, l := range locks {
+		keys = append(keys, l.Key)
+	}
+	if got := strings.Join(keys, ","); got != "list-expired,list-held,list-released" {
+		t.Fatal("unexpected locks:", got)
+	}
+	if svc.pages < len(locks) {
+		t.Fatal("expected paginated scan, got pages:", svc.pages)
+	}
+
+	expired, held, rel := locks[0], locks[1], locks[2]
+	if expired.OwnerName != "List#1" || string(expired.Data) != "expired" || !expired.AppearsExpired || expired.IsReleased {
+		t.Fatalf("unexpected expired lock: %+v", expired)
+	}
+	if held.OwnerName != "List#2" || string(held.Data) != "held" || held.AppearsExpired || held.LeaseDuration != time.Second {
+		t.Fatalf("unexpected held lock: %+v", held)
+	}
+	if time.Since(held.LastUpdated) > time.Second {
+		t.Fatal("heartbeats should have updated the lock:", held.LastUpdated)
+	}
+	if !rel.IsReleased || !rel.AppearsExpired {
+		t.Fatalf("unexpected released lock: %+v", rel)
+	}
+
+	l, err := c2.GetWithContext(ctx, "list-expired")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info := l.Info(); info.Key != expired.Key || info.OwnerName != expired.OwnerName || info.FencingToken != expired.FencingToken || !info.AppearsExpired {
+		t.Fatalf("unexpected lock info: %+v", info)
+	}
+	live, err := c2.GetWithContext(ctx, "list-held")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 5; i++ {
+		if info := live.Info(); info.OwnerName != "List#2" || info.AppearsExpired {
+			t.Fatalf("unexpected live lock info: %+v", info)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+
+	locks, err = c1.List(ctx, func(l *dynamolock.LockInfo) bool {
+		return l.OwnerName == "List#2"
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].Key != "list-held" {
+		t.Fatal("unexpected filtered locks:", locks)
+	}
+}
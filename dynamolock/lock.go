@@ -17,6 +17,7 @@ limitations under the License.
 package dynamolock
 
 import (
+	"context"
 	"errors"
 	"sync"
 	"time"
@@ -36,9 +37,13 @@ type Lock struct {
 	deleteLockOnRelease bool
 	isReleased          bool
 	sessionMonitor      *sessionMonitor
+	refreshPeriod       time.Duration
+	cancelHeartbeat     context.CancelFunc
 
 	lookupTime           time.Time
 	recordVersionNumber  string
+	fencingToken         int64
+	lastUpdated          time.Time
 	leaseDuration        time.Duration
 	additionalAttributes map[string]*dynamodb.AttributeValue
 }
@@ -88,6 +93,39 @@ func (l *Lock) isExpired() bool {
 	return time.Since(l.lookupTime) > l.leaseDuration
 }
 
+func (l *Lock) timeUntilNextHeartbeat(heartbeatPeriod time.Duration) time.Duration {
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
+	if half := l.leaseDuration / 2; half > 0 && heartbeatPeriod > half {
+		heartbeatPeriod = half
+	}
+	return time.Until(l.lookupTime.Add(heartbeatPeriod))
+}
+
+func (l *Lock) heartbeatName() string {
+	return l.partitionKey
+}
+
+func (l *Lock) retryPeriod() time.Duration {
+	return l.refreshPeriod
+}
+
+func (l *Lock) isTracked() bool {
+	return l.client.isTracked(l)
+}
+
+func (l *Lock) sendHeartbeat(ctx context.Context) error {
+	return l.client.SendHeartbeatWithContext(ctx, l)
+}
+
+// stopHeartbeat interrupts the automatic heartbeats of the lock, if any. It
+// must be called with the semaphore held.
+func (l *Lock) stopHeartbeat() {
+	if l.cancelHeartbeat != nil {
+		l.cancelHeartbeat()
+	}
+}
+
 func (l *Lock) updateRVN(rvn string, lastUpdate time.Time, leaseDuration time.Duration) {
 	l.recordVersionNumber = rvn
 	l.lookupTime = lastUpdate
@@ -102,6 +140,23 @@ func (l *Lock) OwnerName() string {
 	return l.ownerName
 }
 
+// FencingToken returns the lock's fencing token: a number that is
+// incremented every time the lock is acquired. Pass it along to the resources
+// protected by the lock, so they can reject writes carrying a token older than
+// the latest one they have seen - for instance, from an owner whose lease was
+// stolen while it was paused.
+//
+// The sequence is kept in a counter item of its own, which is never deleted,
+// so it carries on when the lock item is deleted on release (see
+// WithDeleteLockOnRelease and WithDeleteLock) or removed by DynamoDB time to
+// live (see WithExpiryAttribute).
+func (l *Lock) FencingToken() int64 {
+	if l == nil {
+		return 0
+	}
+	return l.fencingToken
+}
+
 // AdditionalAttributes returns the lock's additional data stored during
 // acquisition.
 func (l *Lock) AdditionalAttributes() map[string]*dynamodb.AttributeValue {
@@ -146,5 +201,7 @@ func (l *Lock) timeUntilDangerZoneEntered() (time.Duration, error) {
 	if l.IsExpired() {
 		return 0, ErrLockAlreadyReleased
 	}
+	l.semaphore.Lock()
+	defer l.semaphore.Unlock()
 	return l.sessionMonitor.timeUntilLeaseEntersDangerZone(l.lookupTime), nil
 }
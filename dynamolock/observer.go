@@ -0,0 +1,100 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import "time"
+
+// Observer is notified of the activity of the lock client, so it can be
+// plugged into a metrics system. Its methods are called synchronously from the
+// goroutine doing the work, therefore they must be safe for concurrent use and
+// must not block. Embed NopObserver to implement only some of the methods.
+//
+// Shared locks, exclusive locks and semaphore permits are reported just like
+// locks, by the key they belong to.
+type Observer interface {
+	// AcquireAttempt is called every time the client tries to write the
+	// lock item while acquiring a lock; attempts beyond the first one
+	// indicate contention.
+	AcquireAttempt(key string)
+	// AcquireSuccess is called when a lock is acquired, with the time
+	// spent acquiring it.
+	AcquireSuccess(key string, wait time.Duration)
+	// AcquireFailure is called when the client gives up acquiring a lock,
+	// with the time spent trying.
+	AcquireFailure(key string, wait time.Duration, err error)
+	// Release is called after the client tries to release a lock; err is
+	// nil on success.
+	Release(key string, err error)
+	// HeartbeatSuccess is called after every successful heartbeat.
+	HeartbeatSuccess(key string)
+	// HeartbeatFailure is called after every failed heartbeat.
+	HeartbeatFailure(key string, err error)
+	// DangerZoneEntered is called when the session monitor of a lock
+	// detects that the lock entered the danger zone.
+	DangerZoneEntered(key string)
+}
+
+// WithObserver registers an observer for the activity of the lock client.
+func WithObserver(o Observer) ClientOption {
+	return func(c *Client) {
+		c.observer = o
+	}
+}
+
+// NopObserver is an Observer that ignores all notifications.
+type NopObserver struct{}
+
+var _ Observer = NopObserver{}
+
+// AcquireAttempt implements Observer.
+func (NopObserver) AcquireAttempt(string) {}
+
+// AcquireSuccess implements Observer.
+func (NopObserver) AcquireSuccess(string, time.Duration) {}
+
+// AcquireFailure implements Observer.
+func (NopObserver) AcquireFailure(string, time.Duration, error) {}
+
+// Release implements Observer.
+func (NopObserver) Release(string, error) {}
+
+// HeartbeatSuccess implements Observer.
+func (NopObserver) HeartbeatSuccess(string) {}
+
+// HeartbeatFailure implements Observer.
+func (NopObserver) HeartbeatFailure(string, error) {}
+
+// DangerZoneEntered implements Observer.
+func (NopObserver) DangerZoneEntered(string) {}
+
+// observeAcquisition reports the outcome of an acquisition that started at
+// the given time.
+func (c *Client) observeAcquisition(key string, start time.Time, err error) {
+	if err != nil {
+		c.observer.AcquireFailure(key, time.Since(start), err)
+		return
+	}
+	c.observer.AcquireSuccess(key, time.Since(start))
+}
+
+func (c *Client) observeHeartbeat(key string, err error) {
+	if err != nil {
+		c.observer.HeartbeatFailure(key, err)
+		return
+	}
+	c.observer.HeartbeatSuccess(key)
+}
@@ -0,0 +1,147 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+type recordingObserver struct {
+	dynamolock.NopObserver
+
+	mu     sync.Mutex
+	events map[string]int
+	waits  []time.Duration
+}
+
+func (o *recordingObserver) record(event string) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	if o.events == nil {
+		o.events = make(map[string]int)
+	}
+	o.events[event]++
+}
+
+func (o *recordingObserver) count(event string) int {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+	return o.events[event]
+}
+
+func (o *recordingObserver) AcquireAttempt(key string) {
+	o.record("attempt:" + key)
+}
+
+func (o *recordingObserver) AcquireSuccess(key string, wait time.Duration) {
+	o.mu.Lock()
+	o.waits = append(o.waits, wait)
+	o.mu.Unlock()
+	o.record("success:" + key)
+}
+
+func (o *recordingObserver) AcquireFailure(key string, wait time.Duration, err error) {
+	o.record("failure:" + key)
+}
+
+func (o *recordingObserver) Release(key string, err error) {
+	if err == nil {
+		o.record("release:" + key)
+	}
+}
+
+func (o *recordingObserver) HeartbeatSuccess(key string) {
+	o.record("heartbeat:" + key)
+}
+
+func (o *recordingObserver) HeartbeatFailure(key string, err error) {
+	o.record("heartbeatFailure:" + key)
+}
+
+func (o *recordingObserver) DangerZoneEntered(key string) {
+	o.record("dangerZone:" + key)
+}
+
+func TestObserver(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	o := &recordingObserver{}
+	c := newRWClient(t, svc, "Observer#1", dynamolock.WithObserver(o))
+	defer c.Close()
+	other := newRWClient(t, svc, "Observer#2", dynamolock.WithObserver(o))
+	defer other.Close()
+
+	l, err := c.AcquireLock("observed")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := other.AcquireLock("observed", dynamolock.FailIfLocked()); err == nil {
+		t.Fatal("expected lock to be held")
+	}
+	time.Sleep(500 * time.Millisecond)
+	if _, err := c.ReleaseLock(l); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := o.count("attempt:observed"); got != 1 {
+		t.Error("unexpected number of attempts:", got)
+	}
+	if got := o.count("success:observed"); got != 1 {
+		t.Error("unexpected number of successes:", got)
+	}
+	if got := o.count("failure:observed"); got != 1 {
+		t.Error("unexpected number of failures:", got)
+	}
+	if got := o.count("release:observed"); got != 1 {
+		t.Error("unexpected number of releases:", got)
+	}
+	if got := o.count("heartbeat:observed"); got == 0 {
+		t.Error("heartbeats were not observed")
+	}
+
+	t.Log("losing lock")
+	lost, err := c.AcquireLock("observedLost",
+		dynamolock.WithSessionMonitor(500*time.Millisecond, func() {}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = svc.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String("locks"),
+		Key: map[string]*dynamodb.AttributeValue{
+			"key": {S: aws.String("observedLost")},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if !lost.IsExpired() {
+		t.Fatal("lock should have been lost")
+	}
+	if got := o.count("heartbeatFailure:observedLost"); got == 0 {
+		t.Error("heartbeat failure was not observed")
+	}
+	if got := o.count("dangerZone:observedLost"); got != 1 {
+		t.Error("unexpected number of danger zone entries:", got)
+	}
+}
@@ -0,0 +1,227 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+)
+
+const (
+	attrWriter       = "writer"
+	readerAttrPrefix = "reader:"
+
+	writerPathExpressionVariable = "#w"
+)
+
+var writerDoesntExistCondition = fmt.Sprintf("attribute_not_exists(%s)", writerPathExpressionVariable)
+
+// RWLock is a shared (reader) or exclusive (writer) lock. Any number of
+// shared locks can be held for a given key at the same time, as long as no
+// one holds the exclusive lock. Both kinds are kept alive by heartbeats, so
+// the lease of a crashed owner expires like the lease of a regular Lock.
+//
+// Keys used with AcquireSharedLock and AcquireExclusiveLock must not be used
+// with AcquireLock, as the lock items have different layouts.
+type RWLock struct {
+	lease     *lease
+	exclusive bool
+}
+
+// IsExclusive tells whether this is an exclusive (writer) lock.
+func (l *RWLock) IsExclusive() bool {
+	return l != nil && l.exclusive
+}
+
+// IsExpired returns if the lock is expired, released, or neither.
+func (l *RWLock) IsExpired() bool {
+	if l == nil {
+		return true
+	}
+	return l.lease.isExpired()
+}
+
+// Close releases the lock.
+func (l *RWLock) Close() error {
+	return l.CloseWithContext(context.Background())
+}
+
+// CloseWithContext releases the lock. The given context is passed down to the
+// underlying dynamoDB call.
+func (l *RWLock) CloseWithContext(ctx context.Context) error {
+	if l == nil {
+		return ErrCannotReleaseNullLock
+	}
+	return l.lease.client.releaseLease(ctx, l.lease)
+}
+
+// AcquireSharedLock holds a shared lock for the given key. It waits while an
+// exclusive lock is held or requested for the key, so writers are not starved
+// by a continuous flow of readers. FailIfLocked, WithRefreshPeriod,
+// WithAdditionalTimeToWaitForLock and WithHeartbeatErrorHandler are honored;
+// other options are ignored.
+func (c *Client) AcquireSharedLock(key string, opts ...AcquireLockOption) (*RWLock, error) {
+	return c.AcquireSharedLockWithContext(context.Background(), key, opts...)
+}
+
+// AcquireSharedLockWithContext holds a shared lock for the given key. The
+// given context is passed down to the underlying dynamoDB calls and it also
+// interrupts the wait for the lock.
+func (c *Client) AcquireSharedLockWithContext(ctx context.Context, key string, opts ...AcquireLockOption) (*RWLock, error) {
+	return c.acquireRWLock(ctx, key, false, opts)
+}
+
+// AcquireExclusiveLock holds an exclusive lock for the given key. As soon as
+// it is requested, new shared locks are refused; then it waits for the
+// current shared locks to be released or to expire. FailIfLocked,
+// WithRefreshPeriod, WithAdditionalTimeToWaitForLock and
+// WithHeartbeatErrorHandler are honored; other options are ignored.
+func (c *Client) AcquireExclusiveLock(key string, opts ...AcquireLockOption) (*RWLock, error) {
+	return c.AcquireExclusiveLockWithContext(context.Background(), key, opts...)
+}
+
+// AcquireExclusiveLockWithContext holds an exclusive lock for the given key.
+// The given context is passed down to the underlying dynamoDB calls and it
+// also interrupts the wait for the lock.
+func (c *Client) AcquireExclusiveLockWithContext(ctx context.Context, key string, opts ...AcquireLockOption) (*RWLock, error) {
+	return c.acquireRWLock(ctx, key, true, opts)
+}
+
+func (c *Client) acquireRWLock(ctx context.Context, key string, exclusive bool, opts []AcquireLockOption) (_ *RWLock, err error) {
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	req := &acquireLockOptions{
+		partitionKey: key,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	// Hold the read lock when acquiring locks. This prevents us from
+	// acquiring a lock while the Client is being closed as we hold the
+	// write lock during close.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	a := newLeaseAcquisition(req)
+	defer func() {
+		c.observeAcquisition(key, a.start, err)
+	}()
+	var l *lease
+	if exclusive {
+		l, err = c.acquireLease(ctx, a, attrWriter, "", nil)
+	} else {
+		l, err = c.acquireLease(ctx, a, readerAttrPrefix+c.generateRecordVersionNumber(),
+			writerDoesntExistCondition, map[string]*string{writerPathExpressionVariable: aws.String(attrWriter)})
+	}
+	if err != nil {
+		return nil, err
+	}
+	c.startLeaseHeartbeat(l, a.refreshPeriod, req.heartbeatErrorHandler)
+	if exclusive {
+		if err = c.waitForReaders(ctx, a); err != nil {
+			c.releaseLease(context.Background(), l)
+			return nil, err
+		}
+	}
+	return &RWLock{lease: l, exclusive: exclusive}, nil
+}
+
+// acquireLease claims the lease stored in attribute attr as soon as no one
+// holds the writer lease, removing it if it expires.
+func (c *Client) acquireLease(ctx context.Context, a *leaseAcquisition, attr, condition string, names map[string]*string) (*lease, error) {
+	for {
+		item, err := c.readLeases(ctx, a.key)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctxLockNotGrantedError(ctx)
+		} else if err != nil {
+			return nil, err
+		}
+		if writer, ok := parseLeaseEntry(attrWriter, item[attrWriter]); ok {
+			if !a.watcher.isExpired(writer) {
+				err = a.wait(ctx, &writer)
+			} else {
+				_, err = c.expireLease(ctx, a.key, writer)
+			}
+			if err != nil {
+				return nil, err
+			}
+			continue
+		}
+		l, err := c.claimLease(ctx, a.key, attr, condition, names)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctxLockNotGrantedError(ctx)
+		} else if isLockNotGrantedError(err) {
+			if err := a.wait(ctx, nil); err != nil {
+				return nil, err
+			}
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+// waitForReaders blocks until all the reader leases are gone. It is called by
+// writers while holding the writer lease, which prevents new readers.
+func (c *Client) waitForReaders(ctx context.Context, a *leaseAcquisition) error {
+	for {
+		item, err := c.readLeases(ctx, a.key)
+		if err != nil && ctx.Err() != nil {
+			return ctxLockNotGrantedError(ctx)
+		} else if err != nil {
+			return err
+		}
+		var holder *leaseEntry
+		expired := false
+		for attr, v := range item {
+			if !strings.HasPrefix(attr, readerAttrPrefix) {
+				continue
+			}
+			reader, ok := parseLeaseEntry(attr, v)
+			if !ok {
+				continue
+			}
+			if !a.watcher.isExpired(reader) {
+				holder = &reader
+				continue
+			}
+			if _, err := c.expireLease(ctx, a.key, reader); err != nil {
+				return err
+			}
+			expired = true
+		}
+		if holder != nil {
+			if err := a.wait(ctx, holder); err != nil {
+				return err
+			}
+		} else if !expired {
+			return nil
+		}
+	}
+}
@@ -0,0 +1,209 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+	"golang.org/x/xerrors"
+)
+
+func newRWClient(t *testing.T, svc dynamodbiface.DynamoDBAPI, owner string, opts ...dynamolock.ClientOption) *dynamolock.Client {
+	t.Helper()
+	opts = append([]dynamolock.ClientOption{
+		dynamolock.WithLeaseDuration(1 * time.Second),
+		dynamolock.WithHeartbeatPeriod(100 * time.Millisecond),
+		dynamolock.WithOwnerName(owner),
+		dynamolock.WithPartitionKeyName("key"),
+	}, opts...)
+	c, err := dynamolock.New(svc, "locks", opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ensuring table exists")
+	c.CreateTable("locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+	)
+	return c
+}
+
+func isLockNotGranted(err error) bool {
+	var errNotGranted *dynamolock.LockNotGrantedError
+	return xerrors.As(err, &errNotGranted)
+}
+
+func TestSharedLocks(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	reader1 := newRWClient(t, svc, "SharedLocks#1")
+	defer reader1.Close()
+	reader2 := newRWClient(t, svc, "SharedLocks#2")
+	defer reader2.Close()
+	writer := newRWClient(t, svc, "SharedLocks#3")
+	defer writer.Close()
+
+	const key = "sharedLocks"
+	r1, err := reader1.AcquireSharedLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r2, err := reader2.AcquireSharedLock(key, dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("readers must not block each other:", err)
+	}
+	if r1.IsExclusive() || r1.IsExpired() {
+		t.Fatal("unexpected shared lock state")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if r1.IsExpired() || r2.IsExpired() {
+		t.Fatal("heartbeats should have kept the shared locks")
+	}
+
+	_, err = writer.AcquireExclusiveLock(key, dynamolock.FailIfLocked())
+	if !isLockNotGranted(err) {
+		t.Fatal("writer must not acquire the lock while there are readers:", err)
+	}
+
+	if err := r1.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := r2.Close(); err != nil {
+		t.Fatal(err)
+	}
+	w, err := writer.AcquireExclusiveLock(key, dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("writer must acquire the lock once readers are gone:", err)
+	}
+	if !w.IsExclusive() {
+		t.Fatal("exclusive lock expected")
+	}
+	if _, err := reader1.AcquireSharedLock(key, dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("reader must not acquire the lock while there is a writer:", err)
+	}
+	if _, err := writer.AcquireExclusiveLock(key, dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("writers must exclude each other:", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != dynamolock.ErrLockAlreadyReleased {
+		t.Fatal("expected already released error:", err)
+	}
+	r1, err = reader1.AcquireSharedLock(key, dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("reader must acquire the lock after the writer is gone:", err)
+	}
+	if err := r1.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader1.AcquireSharedLock("dynamolock.fencing#" + key); err != dynamolock.ErrReservedKey {
+		t.Fatal("expected ErrReservedKey for shared lock:", err)
+	}
+	if _, err := writer.AcquireExclusiveLock("dynamolock.fencing#" + key); err != dynamolock.ErrReservedKey {
+		t.Fatal("expected ErrReservedKey for exclusive lock:", err)
+	}
+}
+
+func TestExclusiveLockWriterPreference(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	reader := newRWClient(t, svc, "WriterPreference#1")
+	defer reader.Close()
+	writer := newRWClient(t, svc, "WriterPreference#2")
+	defer writer.Close()
+
+	const key = "writerPreference"
+	r, err := reader.AcquireSharedLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	acquired := make(chan *dynamolock.RWLock, 1)
+	go func() {
+		w, err := writer.AcquireExclusiveLock(key,
+			dynamolock.WithRefreshPeriod(100*time.Millisecond),
+			dynamolock.WithAdditionalTimeToWaitForLock(5*time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- w
+	}()
+
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case <-acquired:
+		t.Fatal("writer must wait for the reader")
+	default:
+	}
+	if _, err := reader.AcquireSharedLock(key, dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("new readers must wait for the pending writer:", err)
+	}
+
+	if err := r.Close(); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case w := <-acquired:
+		if w == nil {
+			t.Fatal("writer did not get the lock")
+		}
+		w.Close()
+	case <-time.After(5 * time.Second):
+		t.Fatal("writer did not get the lock after the reader left")
+	}
+}
+
+func TestSharedLockExpiration(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	crashed := newRWClient(t, svc, "SharedLockExpiration#1", dynamolock.DisableHeartbeat())
+	defer crashed.Close()
+	writer := newRWClient(t, svc, "SharedLockExpiration#2")
+	defer writer.Close()
+
+	const key = "sharedLockExpiration"
+	r, err := crashed.AcquireSharedLock(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	start := time.Now()
+	w, err := writer.AcquireExclusiveLock(key, dynamolock.WithRefreshPeriod(100*time.Millisecond))
+	if err != nil {
+		t.Fatal("writer must take over once the reader lease expires:", err)
+	}
+	if time.Since(start) < time.Second {
+		t.Fatal("writer did not wait for the reader lease to expire")
+	}
+	if !r.IsExpired() {
+		t.Fatal("reader lease should be expired")
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,176 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock
+
+import (
+	"context"
+	"errors"
+	"strconv"
+)
+
+const permitAttrPrefix = "permit:"
+
+// Semaphore is a counting semaphore: it allows up to a fixed number of permits
+// to be held for the same key at the same time, across clients. Each permit
+// is a lease in the lock item of the key, heartbeated and released like a
+// Lock.
+//
+// All the semaphores of a key must be created with the same number of
+// permits, and the key must not be used with AcquireLock or with shared and
+// exclusive locks.
+type Semaphore struct {
+	client  *Client
+	key     string
+	permits int
+}
+
+// Permit is a permit held from a Semaphore.
+type Permit struct {
+	lease *lease
+}
+
+// IsExpired returns if the permit is expired, released, or neither.
+func (p *Permit) IsExpired() bool {
+	if p == nil {
+		return true
+	}
+	return p.lease.isExpired()
+}
+
+// Close releases the permit.
+func (p *Permit) Close() error {
+	if p == nil {
+		return ErrCannotReleaseNullLock
+	}
+	return p.lease.client.releaseLease(context.Background(), p.lease)
+}
+
+// NewSemaphore creates a semaphore with the given number of permits for key.
+func (c *Client) NewSemaphore(key string, permits int) (*Semaphore, error) {
+	if permits < 1 {
+		return nil, errors.New("semaphore must have at least one permit")
+	}
+	if err := checkKey(key); err != nil {
+		return nil, err
+	}
+	return &Semaphore{
+		client:  c,
+		key:     key,
+		permits: permits,
+	}, nil
+}
+
+// AcquirePermit holds one of the semaphore's permits, waiting for one to be
+// released or to expire if all of them are held. FailIfLocked,
+// WithRefreshPeriod, WithAdditionalTimeToWaitForLock and
+// WithHeartbeatErrorHandler are honored; other options are ignored.
+func (s *Semaphore) AcquirePermit(opts ...AcquireLockOption) (*Permit, error) {
+	return s.AcquirePermitWithContext(context.Background(), opts...)
+}
+
+// AcquirePermitWithContext holds one of the semaphore's permits. The given
+// context is passed down to the underlying dynamoDB calls and it also
+// interrupts the wait for the permit.
+func (s *Semaphore) AcquirePermitWithContext(ctx context.Context, opts ...AcquireLockOption) (_ *Permit, err error) {
+	c := s.client
+	if c.isClosed() {
+		return nil, ErrClientClosed
+	}
+	req := &acquireLockOptions{
+		partitionKey: s.key,
+	}
+	for _, opt := range opts {
+		opt(req)
+	}
+
+	// Hold the read lock when acquiring locks. This prevents us from
+	// acquiring a lock while the Client is being closed as we hold the
+	// write lock during close.
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	if c.closed {
+		return nil, ErrClientClosed
+	}
+
+	a := newLeaseAcquisition(req)
+	defer func() {
+		c.observeAcquisition(s.key, a.start, err)
+	}()
+	for {
+		var l *lease
+		l, err = s.tryAcquirePermit(ctx, a)
+		if err != nil && ctx.Err() != nil {
+			return nil, ctxLockNotGrantedError(ctx)
+		} else if err != nil {
+			return nil, err
+		} else if l != nil {
+			c.startLeaseHeartbeat(l, a.refreshPeriod, req.heartbeatErrorHandler)
+			return &Permit{lease: l}, nil
+		}
+	}
+}
+
+// tryAcquirePermit claims the first free permit, removing the expired ones
+// on the way. When all permits are taken, it waits a refresh period and
+// returns a nil lease.
+func (s *Semaphore) tryAcquirePermit(ctx context.Context, a *leaseAcquisition) (*lease, error) {
+	c := s.client
+	item, err := c.readLeases(ctx, s.key)
+	if err != nil {
+		return nil, err
+	}
+	var holder *leaseEntry
+	for i := 0; i < s.permits; i++ {
+		attr := permitAttrPrefix + strconv.Itoa(i)
+		permit, ok := parseLeaseEntry(attr, item[attr])
+		if ok && !a.watcher.isExpired(permit) {
+			if holder == nil {
+				holder = &permit
+			}
+			continue
+		} else if ok {
+			if expired, err := c.expireLease(ctx, s.key, permit); err != nil {
+				return nil, err
+			} else if !expired {
+				continue
+			}
+		}
+		l, err := c.claimLease(ctx, s.key, attr, "", nil)
+		if isLockNotGrantedError(err) {
+			// someone else got this permit in the meantime.
+			continue
+		} else if err != nil {
+			return nil, err
+		}
+		return l, nil
+	}
+	return nil, a.wait(ctx, holder)
+}
+
+// ReleasePermit releases the given permit.
+func (s *Semaphore) ReleasePermit(p *Permit) error {
+	return s.ReleasePermitWithContext(context.Background(), p)
+}
+
+// ReleasePermitWithContext releases the given permit. The given context is
+// passed down to the underlying dynamoDB call.
+func (s *Semaphore) ReleasePermitWithContext(ctx context.Context, p *Permit) error {
+	if p == nil {
+		return ErrCannotReleaseNullLock
+	}
+	return s.client.releaseLease(ctx, p.lease)
+}
@@ -0,0 +1,136 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+)
+
+func TestSemaphore(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	const key = "semaphore"
+	var sems []*dynamolock.Semaphore
+	for _, owner := range []string{"Semaphore#1", "Semaphore#2", "Semaphore#3"} {
+		c := newRWClient(t, svc, owner)
+		defer c.Close()
+		s, err := c.NewSemaphore(key, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sems = append(sems, s)
+		if _, err := c.NewSemaphore("dynamolock.fencing#"+key, 2); err != dynamolock.ErrReservedKey {
+			t.Fatal("expected ErrReservedKey:", err)
+		}
+	}
+
+	p1, err := sems[0].AcquirePermit()
+	if err != nil {
+		t.Fatal(err)
+	}
+	p2, err := sems[1].AcquirePermit(dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("second permit must be available:", err)
+	}
+	if _, err := sems[2].AcquirePermit(dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("third permit must not be granted:", err)
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if p1.IsExpired() || p2.IsExpired() {
+		t.Fatal("heartbeats should have kept the permits")
+	}
+
+	acquired := make(chan *dynamolock.Permit, 1)
+	go func() {
+		p, err := sems[2].AcquirePermit(
+			dynamolock.WithRefreshPeriod(100*time.Millisecond),
+			dynamolock.WithAdditionalTimeToWaitForLock(5*time.Second))
+		if err != nil {
+			t.Error(err)
+		}
+		acquired <- p
+	}()
+	time.Sleep(300 * time.Millisecond)
+	if err := sems[0].ReleasePermit(p1); err != nil {
+		t.Fatal(err)
+	}
+	select {
+	case p3 := <-acquired:
+		if p3 == nil {
+			t.Fatal("permit not granted")
+		}
+		if err := p3.Close(); err != nil {
+			t.Fatal(err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("permit not granted after release")
+	}
+	if err := sems[1].ReleasePermit(p2); err != nil {
+		t.Fatal(err)
+	}
+	if err := sems[1].ReleasePermit(p2); err != dynamolock.ErrLockAlreadyReleased {
+		t.Fatal("expected already released error:", err)
+	}
+}
+
+func TestSemaphoreExpiration(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	const key = "semaphoreExpiration"
+	crashed := newRWClient(t, svc, "SemaphoreExpiration#1", dynamolock.DisableHeartbeat())
+	defer crashed.Close()
+	c := newRWClient(t, svc, "SemaphoreExpiration#2")
+	defer c.Close()
+
+	s1, err := crashed.NewSemaphore(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s1.AcquirePermit(); err != nil {
+		t.Fatal(err)
+	}
+	s2, err := c.NewSemaphore(key, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start := time.Now()
+	p, err := s2.AcquirePermit(dynamolock.WithRefreshPeriod(100 * time.Millisecond))
+	if err != nil {
+		t.Fatal("permit must be granted once the abandoned one expires:", err)
+	}
+	if time.Since(start) < time.Second {
+		t.Fatal("permit granted before the abandoned one expired")
+	}
+	if err := p.Close(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestInvalidSemaphore(t *testing.T) {
+	t.Parallel()
+	c, err := dynamolock.New(newDynamoDB(t), "locks")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := c.NewSemaphore("invalidSemaphore", 0); err == nil {
+		t.Fatal("expected error for semaphore without permits")
+	}
+}
@@ -0,0 +1,126 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/aws/aws-sdk-go/service/dynamodb/dynamodbiface"
+)
+
+func newNamespacedClient(t *testing.T, svc dynamodbiface.DynamoDBAPI, owner, namespace string) *dynamolock.Client {
+	t.Helper()
+	c, err := dynamolock.New(svc, "namespaced_locks",
+		dynamolock.WithLeaseDuration(1*time.Second),
+		dynamolock.WithHeartbeatPeriod(100*time.Millisecond),
+		dynamolock.WithOwnerName(owner),
+		dynamolock.WithPartitionKeyName("key"),
+		dynamolock.WithSortKey("namespace", namespace),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log("ensuring table exists")
+	c.CreateTable("namespaced_locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+		dynamolock.WithCustomSortKeyName("namespace"),
+	)
+	return c
+}
+
+func TestSortKey(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	team1 := newNamespacedClient(t, svc, "SortKey#1", "team1")
+	defer team1.Close()
+	team2 := newNamespacedClient(t, svc, "SortKey#2", "team2")
+	defer team2.Close()
+	team1Again := newNamespacedClient(t, svc, "SortKey#3", "team1")
+	defer team1Again.Close()
+
+	l1, err := team1.AcquireLock("sortkey", dynamolock.WithData([]byte("team1")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	l2, err := team2.AcquireLock("sortkey", dynamolock.WithData([]byte("team2")), dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal("locks of different namespaces must not conflict:", err)
+	}
+	if _, ok := l1.AdditionalAttributes()["namespace"]; ok {
+		t.Fatal("sort key should not be exposed as an additional attribute")
+	}
+
+	time.Sleep(1500 * time.Millisecond)
+	if l1.IsExpired() || l2.IsExpired() {
+		t.Fatal("heartbeats should have kept the locks alive")
+	}
+	if _, err := team1Again.AcquireLock("sortkey", dynamolock.FailIfLocked()); !isLockNotGranted(err) {
+		t.Fatal("lock of the same namespace should be held:", err)
+	}
+	got, err := team1Again.Get("sortkey")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.OwnerName() != "SortKey#1" || string(got.Data()) != "team1" {
+		t.Fatal("unexpected lock of team1:", got.OwnerName(), string(got.Data()))
+	}
+
+	locks, err := team2.List(context.Background(), nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(locks) != 1 || locks[0].OwnerName != "SortKey#2" {
+		t.Fatal("list should only return the locks of the namespace:", locks)
+	}
+
+	if _, err := team1.AcquireLock("sortkey-reserved", dynamolock.WithAdditionalAttributes(map[string]*dynamodb.AttributeValue{
+		"namespace": {S: aws.String("team2")},
+	})); err == nil {
+		t.Fatal("the sort key should be reserved")
+	}
+
+	if _, err := team1.ReleaseLock(l1, dynamolock.WithDeleteLock(true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := team2.ReleaseLock(l2); err != nil {
+		t.Fatal(err)
+	}
+	rw, err := team1Again.AcquireExclusiveLock("sortkey-rw", dynamolock.FailIfLocked())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rw.Close()
+	if _, err := team2.AcquireExclusiveLock("sortkey-rw", dynamolock.FailIfLocked()); err != nil {
+		t.Fatal("exclusive locks of different namespaces must not conflict:", err)
+	}
+}
+
+func TestSortKeyValidation(t *testing.T) {
+	t.Parallel()
+	if _, err := dynamolock.New(newDynamoDB(t), "namespaced_locks", dynamolock.WithSortKey("namespace", "")); err == nil {
+		t.Fatal("expected error for empty sort key value")
+	}
+}
@@ -32,6 +32,7 @@ type acquireLockOptions struct {
 	additionalTimeToWaitForLock time.Duration
 	additionalAttributes        map[string]*dynamodb.AttributeValue
 	sessionMonitor              *sessionMonitor
+	heartbeatErrorHandler       func(error)
 }
 
 type getLockOptions struct {
@@ -60,5 +61,8 @@ type createDynamoDBTableOptions struct {
 	provisionedThroughput *dynamodb.ProvisionedThroughput
 	tableName             string
 	partitionKeyName      string
+	sortKeyName           string
 	tags                  []*dynamodb.Tag
+
+	timeToLiveAttributeName string
 }
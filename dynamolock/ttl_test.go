@@ -0,0 +1,116 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package dynamolock_test
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"cirello.io/dynamolock"
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+func TestTimeToLive(t *testing.T) {
+	t.Parallel()
+	svc := newDynamoDB(t)
+	const gracePeriod = time.Hour
+	c, err := dynamolock.New(svc, "ttl_locks",
+		dynamolock.WithLeaseDuration(1*time.Second),
+		dynamolock.WithHeartbeatPeriod(100*time.Millisecond),
+		dynamolock.WithOwnerName("TimeToLive#1"),
+		dynamolock.WithPartitionKeyName("key"),
+		dynamolock.WithExpiryAttribute("expiresAt", gracePeriod),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer c.Close()
+	t.Log("ensuring table exists")
+	c.CreateTable("ttl_locks",
+		dynamolock.WithProvisionedThroughput(&dynamodb.ProvisionedThroughput{
+			ReadCapacityUnits:  aws.Int64(5),
+			WriteCapacityUnits: aws.Int64(5),
+		}),
+		dynamolock.WithCustomPartitionKeyName("key"),
+		dynamolock.WithTimeToLive("expiresAt"),
+	)
+	ttl, err := svc.DescribeTimeToLive(&dynamodb.DescribeTimeToLiveInput{TableName: aws.String("ttl_locks")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if desc := ttl.TimeToLiveDescription; aws.StringValue(desc.TimeToLiveStatus) != dynamodb.TimeToLiveStatusEnabled || aws.StringValue(desc.AttributeName) != "expiresAt" {
+		t.Fatal("time to live not enabled:", desc)
+	}
+
+	expiresAt := func(key string) int64 {
+		t.Helper()
+		out, err := svc.GetItem(&dynamodb.GetItemInput{
+			TableName:      aws.String("ttl_locks"),
+			Key:            map[string]*dynamodb.AttributeValue{"key": {S: aws.String(key)}},
+			ConsistentRead: aws.Bool(true),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		v, ok := out.Item["expiresAt"]
+		if !ok {
+			t.Fatal("missing expiry attribute:", out.Item)
+		}
+		n, err := strconv.ParseInt(aws.StringValue(v.N), 10, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return n
+	}
+
+	before := time.Now()
+	lock, err := c.AcquireLock("ttl")
+	if err != nil {
+		t.Fatal(err)
+	}
+	acquired := expiresAt("ttl")
+	if min := before.Add(gracePeriod).Unix(); acquired < min || acquired > min+5 {
+		t.Fatal("unexpected expiry on acquisition:", acquired, "expected about", min)
+	}
+	if _, ok := lock.AdditionalAttributes()["expiresAt"]; ok {
+		t.Fatal("expiry attribute should not be exposed as an additional attribute")
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if heartbeat := expiresAt("ttl"); heartbeat <= acquired {
+		t.Fatal("heartbeats should push the expiry forward:", acquired, heartbeat)
+	}
+	if _, err := c.ReleaseLock(lock); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := c.AcquireLock("ttl-reserved", dynamolock.WithAdditionalAttributes(map[string]*dynamodb.AttributeValue{
+		"expiresAt": {N: aws.String("0")},
+	})); err == nil {
+		t.Fatal("the expiry attribute should be reserved")
+	}
+
+	shared, err := c.AcquireSharedLock("ttl-shared")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer shared.Close()
+	if got := expiresAt("ttl-shared"); got < before.Add(gracePeriod).Unix() {
+		t.Fatal("unexpected expiry of shared lock:", got)
+	}
+}
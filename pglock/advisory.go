@@ -0,0 +1,163 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"database/sql"
+	"hash/fnv"
+)
+
+// WithAdvisoryLocks makes the client use PostgreSQL's session-level advisory
+// locks instead of lock entries in a table. Each lock holds a dedicated
+// connection from the pool, and it is released when the lock is released or
+// when the connection is lost. Acquire, AcquireShared, AcquireSemaphore,
+// Release and Do keep working the same way, while heartbeats check that the
+// connection is still alive. Lock data, KeepOnRelease, Get, GetData, List,
+// ForceRelease and History need the lock table, so they fail with
+// ErrNotSupportedWithAdvisoryLocks; no table is needed otherwise.
+//
+// Lock names are hashed into the 64-bit keys of advisory locks, along with the
+// table name set by WithCustomTable, so clients of different tables do not
+// collide.
+func WithAdvisoryLocks() ClientOption {
+	return func(c *Client) { c.advisory = true }
+}
+
+// checkAdvisoryLock refuses the options that advisory locks cannot honor.
+func (c *Client) checkAdvisoryLock(l *Lock) error {
+	if c.advisory && (l.data != nil || l.replaceData || l.keepOnRelease) {
+		return ErrNotSupportedWithAdvisoryLocks
+	}
+	return nil
+}
+
+func (c *Client) advisoryKey(name string) int64 {
+	h := fnv.New64a()
+	h.Write([]byte(c.tableName))
+	h.Write([]byte{0})
+	h.Write([]byte(name))
+	return int64(h.Sum64())
+}
+
+// acquireAdvisory waits for the advisory lock within PostgreSQL itself.
+func (c *Client) acquireAdvisory(ctx context.Context, l *Lock) (*Lock, error) {
+	err := c.retry(func() error { return c.storeAcquireAdvisory(ctx, l, true) })
+	if err != nil && ctx.Err() != nil {
+		return nil, ErrNotAcquired
+	} else if err != nil {
+		c.log.Println("error:", err)
+		return nil, err
+	}
+	c.startHeartbeat(l)
+	return l, nil
+}
+
+func (c *Client) storeTryAcquireAdvisory(ctx context.Context, l *Lock) error {
+	return c.storeAcquireAdvisory(ctx, l, false)
+}
+
+func (c *Client) storeAcquireAdvisory(ctx context.Context, l *Lock, wait bool) error {
+	conn, err := c.db.Conn(ctx)
+	if err != nil {
+		return typedError(err, "cannot open connection for advisory lock")
+	}
+	fn := "pg_try_advisory_lock"
+	if wait {
+		fn = "pg_advisory_lock"
+	}
+	if l.shared {
+		fn += "_shared"
+	}
+	key := c.advisoryKey(l.name)
+	acquired := true
+	if wait {
+		_, err = conn.ExecContext(ctx, `SELECT `+fn+`($1)`, key)
+	} else {
+		err = conn.QueryRowContext(ctx, `SELECT `+fn+`($1)`, key).Scan(&acquired)
+	}
+	if err != nil {
+		// The lock might have been granted right before the query was
+		// interrupted.
+		c.endAdvisorySession(conn)
+		return typedError(err, "cannot run query to acquire advisory lock")
+	} else if !acquired {
+		conn.Close()
+		return ErrNotAcquired
+	}
+	l.conn = conn
+	l.advisoryKey = key
+	l.owner = c.owner
+	return nil
+}
+
+func (c *Client) storeHeartbeatAdvisory(ctx context.Context, l *Lock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.isReleased {
+		return ErrLockAlreadyReleased
+	}
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	// Advisory locks live as long as the session that holds them.
+	if _, err := l.conn.ExecContext(ctx, `SELECT 1`); err != nil {
+		l.isReleased = true
+		c.endAdvisorySession(l.conn)
+		return typedError(err, "cannot reach the connection of the advisory lock")
+	}
+	return nil
+}
+
+func (c *Client) storeReleaseAdvisory(ctx context.Context, l *Lock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	fn := "pg_advisory_unlock"
+	if l.shared {
+		fn += "_shared"
+	}
+	l.isReleased = true
+	l.heartbeatCancel()
+	var released bool
+	if err := l.conn.QueryRowContext(ctx, `SELECT `+fn+`($1)`, l.advisoryKey).Scan(&released); err != nil {
+		// Whether or not the session still holds the lock, it is gone
+		// along with the session.
+		c.endAdvisorySession(l.conn)
+		return typedError(err, "cannot run query to release advisory lock")
+	}
+	defer l.conn.Close()
+	if !released {
+		return ErrLockAlreadyReleased
+	}
+	if _, err := l.conn.ExecContext(ctx, `SELECT pg_notify($1, $2)`, c.tableName, l.name); err != nil {
+		return typedError(err, "cannot run query to notify lock release")
+	}
+	return nil
+}
+
+// endAdvisorySession releases every advisory lock the session behind conn
+// might still hold before returning it to the pool. If the session is broken,
+// its locks are gone with it.
+func (c *Client) endAdvisorySession(conn *sql.Conn) {
+	ctx, cancel := context.WithTimeout(context.Background(), c.leaseDuration)
+	defer cancel()
+	if _, err := conn.ExecContext(ctx, `SELECT pg_advisory_unlock_all()`); err != nil {
+		c.log.Println("cannot release the advisory locks of the session:", err)
+	}
+	conn.Close()
+}
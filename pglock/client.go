@@ -24,6 +24,7 @@ import (
 	"log"
 	"math/rand"
 	"net"
+	"os"
 	"time"
 
 	"github.com/lib/pq"
@@ -55,6 +56,12 @@ type Client struct {
 	heartbeatFrequency time.Duration
 	log                Logger
 	owner              string
+	listenerDSN        string
+	notifier           *releaseNotifier
+	advisory           bool
+	history            bool
+	hostname           string
+	pid                int
 }
 
 // New returns a locker client from the given database connection. This function
@@ -85,7 +92,9 @@ func newClient(db *sql.DB, opts ...ClientOption) (_ *Client, err error) {
 		heartbeatFrequency: DefaultHeartbeatFrequency,
 		log:                log.New(ioutil.Discard, "", 0),
 		owner:              fmt.Sprintf("pglock-%v", rand.Int()),
+		pid:                os.Getpid(),
 	}
+	c.hostname, _ = os.Hostname()
 	for _, opt := range opts {
 		opt(c)
 	}
@@ -93,9 +102,21 @@ func newClient(db *sql.DB, opts ...ClientOption) (_ *Client, err error) {
 		db.Close()
 		return nil, ErrDurationTooSmall
 	}
+	if c.listenerDSN != "" {
+		c.startListener()
+	}
 	return c, nil
 }
 
+// Close stops listening to lock releases when the client was created
+// WithListener. It does not close the underlying database connection.
+func (c *Client) Close() error {
+	if c.notifier == nil {
+		return nil
+	}
+	return c.notifier.listener.Close()
+}
+
 func isDurationTooSmall(c *Client) bool {
 	return c.heartbeatFrequency > 0 && c.leaseDuration < 2*c.heartbeatFrequency
 }
@@ -116,16 +137,17 @@ func (c *Client) newLock(ctx context.Context, name string, opts []LockOption) *L
 }
 
 // CreateTable prepares a PostgreSQL table with the right DDL for it to be used
-// by this lock client. If the table already exists, it will return an error.
+// by this lock client. If the table already exists, it will return an error;
+// use Migrate to upgrade tables created by older versions of this package.
+// The history table is created when the client is configured WithHistory.
 func (c *Client) CreateTable() error {
 	cmds := []string{
-		`CREATE TABLE ` + c.tableName + ` (
-			name CHARACTER VARYING(255) PRIMARY KEY,
-			record_version_number BIGINT,
-			data BYTEA,
-			owner CHARACTER VARYING(255)
-		);`,
-		`CREATE SEQUENCE ` + c.tableName + `_rvn OWNED BY ` + c.tableName + `.record_version_number`,
+		c.lockTableDDL(""),
+		c.sequenceDDL(""),
+		c.holdersTableDDL(""),
+	}
+	if c.history {
+		cmds = append(cmds, c.historyTableDDL("")...)
 	}
 	for _, cmd := range cmds {
 		_, err := c.db.Exec(cmd)
@@ -144,36 +166,125 @@ func (c *Client) Acquire(name string, opts ...LockOption) (*Lock, error) {
 
 // AcquireContext attempts to grab the lock with the given key name, wait until
 // it succeeds or the context is done. It returns ErrNotAcquired if the context
-// is canceled before the lock is acquired.
+// is canceled before the lock is acquired. Waiters retry once the lease of the
+// current owner expires, or after a lease duration if the expiry is unknown.
+// When the client is created WithListener, they also retry as soon as the lock
+// is released.
+//
+// Exclusive locks also wait for the shared locks of the same name to be
+// released or to expire; in the meantime, no new shared locks are granted.
+// Names under the prefix of semaphore permits fail with ErrReservedName.
 func (c *Client) AcquireContext(ctx context.Context, name string, opts ...LockOption) (*Lock, error) {
-	l := c.newLock(ctx, name, opts)
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	return c.acquire(ctx, c.newLock(ctx, name, opts))
+}
+
+func (c *Client) acquire(ctx context.Context, l *Lock) (*Lock, error) {
+	if err := c.checkAdvisoryLock(l); err != nil {
+		l.heartbeatCancel()
+		return nil, err
+	}
+	if c.advisory && !l.failIfLocked {
+		return c.acquireAdvisory(ctx, l)
+	}
+	name := l.name
+	var (
+		observedRVN int64
+		observedAt  time.Time
+	)
 	for {
 		select {
 		case <-ctx.Done():
 			return nil, ErrNotAcquired
 		default:
-			err := c.retry(func() error { return c.tryAcquire(ctx, l) })
-			if l.failIfLocked && err == ErrNotAcquired {
-				c.log.Println("not acquired, exit")
-				return l, err
-			} else if err == ErrNotAcquired {
-				c.log.Println("not acquired, wait:", l.leaseDuration)
-				time.Sleep(l.leaseDuration)
-				continue
-			} else if err != nil {
-				c.log.Println("error:", err)
+		}
+		// Register before trying, so a release that happens between the
+		// attempt and the wait is not missed.
+		released, stopWaiting := c.waitRelease(name)
+		if time.Since(observedAt) < l.leaseDuration {
+			// Entries without lease expiry are stolen when their
+			// record version number is unchanged for a lease duration;
+			// woken up before that, only take the lock if it was
+			// indeed released.
+			l.recordVersionNumber = 0
+		}
+		err := c.retry(func() error { return c.tryAcquire(ctx, l) })
+		if l.failIfLocked && err == ErrNotAcquired {
+			stopWaiting()
+			c.log.Println("not acquired, exit")
+			return l, err
+		} else if err == ErrNotAcquired {
+			if l.recordVersionNumber != observedRVN {
+				observedRVN, observedAt = l.recordVersionNumber, time.Now()
+			}
+			err = c.waitAcquire(ctx, l, l.ExpiresAt(), released)
+			stopWaiting()
+			if err != nil {
 				return nil, err
 			}
+			continue
+		}
+		stopWaiting()
+		if err != nil {
+			c.log.Println("error:", err)
+			return nil, err
+		}
+		if l.shared || c.advisory {
 			return l, nil
 		}
+		if err := c.waitSharedHolders(ctx, l); err != nil {
+			c.log.Println("shared holders not released:", err)
+			if err := c.Release(l); err != nil {
+				c.log.Println("cannot release lock:", err)
+			}
+			if err == ErrNotAcquired && l.failIfLocked {
+				return l, err
+			}
+			return nil, err
+		}
+		return l, nil
+	}
+}
+
+// waitAcquire blocks until expiresAt, the release of the lock or, if the expiry
+// is unknown, a lease duration.
+func (c *Client) waitAcquire(ctx context.Context, l *Lock, expiresAt time.Time, released <-chan struct{}) error {
+	wait := l.leaseDuration
+	if !expiresAt.IsZero() && time.Until(expiresAt) < wait {
+		wait = time.Until(expiresAt)
+	}
+	c.log.Println("not acquired, wait:", wait)
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-ctx.Done():
+		return ErrNotAcquired
+	case <-released:
+		c.log.Println("lock released, retry:", l.name)
+	case <-timer.C:
 	}
+	return nil
 }
 
 func (c *Client) tryAcquire(ctx context.Context, l *Lock) error {
-	err := c.storeAcquire(ctx, l)
+	store := c.storeAcquire
+	switch {
+	case c.advisory:
+		store = c.storeTryAcquireAdvisory
+	case l.shared:
+		store = c.storeAcquireShared
+	}
+	err := store(ctx, l)
 	if err != nil {
 		return err
 	}
+	c.startHeartbeat(l)
+	return nil
+}
+
+func (c *Client) startHeartbeat(l *Lock) {
 	if c.heartbeatFrequency > 0 {
 		l.heartbeatWG.Add(1)
 		go func() {
@@ -181,12 +292,12 @@ func (c *Client) tryAcquire(ctx context.Context, l *Lock) error {
 			c.heartbeat(l.heartbeatContext, l)
 		}()
 	}
-	return nil
 }
 
 func (c *Client) storeAcquire(ctx context.Context, l *Lock) error {
 	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
 	defer cancel()
+	start := time.Now()
 	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return typedError(err, "cannot create transaction for lock acquisition")
@@ -199,11 +310,20 @@ func (c *Client) storeAcquire(ctx context.Context, l *Lock) error {
 	defer func() {
 		c.log.Println("storeAcquire out", l.name, rvn, l.data, l.recordVersionNumber)
 	}()
+	var previousOwner sql.NullString
+	if c.history {
+		row := tx.QueryRowContext(ctx, `SELECT "owner" FROM `+c.tableName+` WHERE "name" = $1 AND "record_version_number" IS NOT NULL`, l.name)
+		if err := row.Scan(&previousOwner); err != nil && err != sql.ErrNoRows {
+			return typedError(err, "cannot load the previous owner of the lock")
+		}
+	}
 	_, err = tx.ExecContext(ctx, `
 		INSERT INTO `+c.tableName+`
-			("name", "record_version_number", "data", "owner")
+			("name", "record_version_number", "data", "owner", "lease_expires_at",
+			"owner_hostname", "owner_pid", "acquired_at", "last_heartbeat_at")
 		VALUES
-			($1, $2, $3, $6)
+			($1, $2, $3, $6, now() + make_interval(secs => $7),
+			$8, $9, now(), now())
 		ON CONFLICT ("name") DO UPDATE
 		SET
 			"record_version_number" = $2,
@@ -211,26 +331,45 @@ func (c *Client) storeAcquire(ctx context.Context, l *Lock) error {
 				WHEN $5 THEN $3
 				ELSE `+c.tableName+`."data"
 			END,
-			"owner" = $6
+			"owner" = $6,
+			"lease_expires_at" = EXCLUDED."lease_expires_at",
+			"owner_hostname" = $8,
+			"owner_pid" = $9,
+			"acquired_at" = now(),
+			"last_heartbeat_at" = now()
 		WHERE
 			`+c.tableName+`."record_version_number" IS NULL
-			OR `+c.tableName+`."record_version_number" = $4
-	`, l.name, rvn, l.data, l.recordVersionNumber, l.replaceData, c.owner)
+			OR `+c.tableName+`."lease_expires_at" < now()
+			OR (
+				`+c.tableName+`."lease_expires_at" IS NULL
+				AND `+c.tableName+`."record_version_number" = $4
+			)
+	`, l.name, rvn, l.data, l.recordVersionNumber, l.replaceData, c.owner, l.leaseDuration.Seconds(),
+		c.hostname, c.pid)
 	if err != nil {
 		return typedError(err, "cannot run query to acquire lock")
 	}
-	rowLockInfo := tx.QueryRowContext(ctx, `SELECT "record_version_number", "data", "owner" FROM `+c.tableName+` WHERE name = $1 FOR UPDATE`, l.name)
+	rowLockInfo := tx.QueryRowContext(ctx, `SELECT "record_version_number", "data", "owner", `+leaseRemainingColumn+` FROM `+c.tableName+` WHERE name = $1 FOR UPDATE`, l.name)
 	var actualRVN int64
 	var data []byte
 	var actualOwner string
-	if err := rowLockInfo.Scan(&actualRVN, &data, &actualOwner); err != nil {
+	var leaseRemaining sql.NullFloat64
+	if err := rowLockInfo.Scan(&actualRVN, &data, &actualOwner, &leaseRemaining); err != nil {
 		return typedError(err, "cannot load information for lock acquisition")
 	}
 	l.owner = actualOwner
+	l.expiresAt = leaseExpiry(start, leaseRemaining)
 	if actualRVN != rvn {
 		l.recordVersionNumber = actualRVN
 		return ErrNotAcquired
 	}
+	event := HistoryAcquire
+	if previousOwner.Valid {
+		event = HistorySteal
+	}
+	if err := c.recordHistory(ctx, tx, event, l.name, rvn, previousOwner.String); err != nil {
+		return err
+	}
 	if err := tx.Commit(); err != nil {
 		return typedError(err, "cannot commit lock acquisition")
 	}
@@ -278,6 +417,11 @@ func (c *Client) ReleaseContext(ctx context.Context, l *Lock) error {
 }
 
 func (c *Client) storeRelease(ctx context.Context, l *Lock) error {
+	if c.advisory {
+		return c.storeReleaseAdvisory(ctx, l)
+	} else if l.shared {
+		return c.storeReleaseShared(ctx, l)
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
@@ -290,7 +434,8 @@ func (c *Client) storeRelease(ctx context.Context, l *Lock) error {
 		UPDATE
 			`+c.tableName+`
 		SET
-			"record_version_number" = NULL
+			"record_version_number" = NULL,
+			"lease_expires_at" = NULL
 		WHERE
 			"name" = $1
 			AND "record_version_number" = $2
@@ -317,6 +462,13 @@ func (c *Client) storeRelease(ctx context.Context, l *Lock) error {
 			return typedError(err, "cannot run query to delete lock")
 		}
 	}
+	if err := c.recordHistory(ctx, tx, HistoryRelease, l.name, l.recordVersionNumber, ""); err != nil {
+		return err
+	}
+	// The notification is delivered only if the release is committed.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, c.tableName, l.name); err != nil {
+		return typedError(err, "cannot run query to notify lock release")
+	}
 	if err := tx.Commit(); err != nil {
 		return typedError(err, "cannot commit lock release")
 	}
@@ -351,10 +503,16 @@ func (c *Client) SendHeartbeat(ctx context.Context, l *Lock) error {
 }
 
 func (c *Client) storeHeartbeat(ctx context.Context, l *Lock) error {
+	if c.advisory {
+		return c.storeHeartbeatAdvisory(ctx, l)
+	} else if l.shared {
+		return c.storeHeartbeatShared(ctx, l)
+	}
 	l.mu.Lock()
 	defer l.mu.Unlock()
 	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
 	defer cancel()
+	start := time.Now()
 	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
 	if err != nil {
 		return typedError(err, "cannot create transaction for lock acquisition")
@@ -367,11 +525,13 @@ func (c *Client) storeHeartbeat(ctx context.Context, l *Lock) error {
 		UPDATE
 			`+c.tableName+`
 		SET
-			"record_version_number" = $3
+			"record_version_number" = $3,
+			"lease_expires_at" = now() + make_interval(secs => $4),
+			"last_heartbeat_at" = now()
 		WHERE
 			"name" = $1
 			AND "record_version_number" = $2
-	`, l.name, l.recordVersionNumber, rvn)
+	`, l.name, l.recordVersionNumber, rvn, l.leaseDuration.Seconds())
 	if err != nil {
 		return typedError(err, "cannot run query to update the heartbeat")
 	}
@@ -380,12 +540,14 @@ func (c *Client) storeHeartbeat(ctx context.Context, l *Lock) error {
 		return typedError(err, "cannot confirm whether the lock has been updated for the heartbeat")
 	} else if affected == 0 {
 		l.isReleased = true
+		c.recordLostHeartbeat(ctx, tx, l)
 		return ErrLockAlreadyReleased
 	}
 	if err := tx.Commit(); err != nil {
 		return typedError(err, "cannot commit lock heartbeat")
 	}
 	l.recordVersionNumber = rvn
+	l.expiresAt = start.Add(l.leaseDuration)
 	return nil
 }
 
@@ -404,6 +566,9 @@ func (c *Client) Get(name string) (*Lock, error) {
 // GetDataContext returns the data field from the given lock in the table
 // without holding the lock first.
 func (c *Client) GetDataContext(ctx context.Context, name string) ([]byte, error) {
+	if c.advisory {
+		return nil, ErrNotSupportedWithAdvisoryLocks
+	}
 	l, err := c.GetContext(ctx, name)
 	return l.Data(), err
 }
@@ -411,6 +576,9 @@ func (c *Client) GetDataContext(ctx context.Context, name string) ([]byte, error
 // GetContext returns the lock object from the given name in the table without
 // holding it first.
 func (c *Client) GetContext(ctx context.Context, name string) (*Lock, error) {
+	if c.advisory {
+		return nil, ErrNotSupportedWithAdvisoryLocks
+	}
 	var l *Lock
 	err := c.retry(func() error {
 		var err error
@@ -426,9 +594,10 @@ func (c *Client) GetContext(ctx context.Context, name string) (*Lock, error) {
 func (c *Client) getLock(ctx context.Context, name string) (*Lock, error) {
 	ctx, cancel := context.WithTimeout(ctx, c.leaseDuration)
 	defer cancel()
+	start := time.Now()
 	row := c.db.QueryRowContext(ctx, `
 		SELECT
-			"name", "owner", "data"
+			"name", "owner", "data", `+leaseRemainingColumn+`
 		FROM
 			`+c.tableName+`
 		WHERE
@@ -438,13 +607,28 @@ func (c *Client) getLock(ctx context.Context, name string) (*Lock, error) {
 	l := c.newLock(ctx, name, nil)
 	l.isReleased = true
 	l.recordVersionNumber = -1
-	err := row.Scan(&l.name, &l.owner, &l.data)
+	var leaseRemaining sql.NullFloat64
+	err := row.Scan(&l.name, &l.owner, &l.data, &leaseRemaining)
+	l.expiresAt = leaseExpiry(start, leaseRemaining)
 	if err == sql.ErrNoRows {
 		return l, ErrLockNotFound
 	}
 	return l, typedError(err, "cannot load the data of this lock")
 }
 
+// leaseRemainingColumn reads how many seconds are left in the lease of the
+// lock, according to the database clock. It is NULL if the lease has no expiry.
+const leaseRemainingColumn = `EXTRACT(EPOCH FROM "lease_expires_at" - now())`
+
+// leaseExpiry translates the remaining lease read at start to the local clock,
+// so it is not affected by skew between the client and the database.
+func leaseExpiry(start time.Time, remaining sql.NullFloat64) time.Time {
+	if !remaining.Valid {
+		return time.Time{}
+	}
+	return start.Add(time.Duration(remaining.Float64 * float64(time.Second)))
+}
+
 func (c *Client) getNextRVN(ctx context.Context, tx *sql.Tx) (int64, error) {
 	rowRVN := tx.QueryRowContext(ctx, `SELECT nextval('`+c.tableName+`_rvn')`)
 	var rvn int64
@@ -146,7 +146,7 @@ func TestDBErrorHandling(t *testing.T) {
 			mock.ExpectBegin()
 			mock.ExpectQuery(`SELECT nextval\('locks_rvn'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1))
 			mock.ExpectExec(`INSERT INTO locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
-			mock.ExpectQuery(`SELECT "record_version_number", "data", "owner" FROM locks WHERE name = (.+)`).WillReturnError(badRVN)
+			mock.ExpectQuery(`SELECT "record_version_number", "data", "owner", (.+) FROM locks WHERE name = (.+)`).WillReturnError(badRVN)
 			if _, err := client.Acquire("bad-insert"); !xerrors.Is(err, badRVN) {
 				t.Errorf("expected RVN confirmation error missing: %v", err)
 			}
@@ -157,12 +157,13 @@ func TestDBErrorHandling(t *testing.T) {
 			mock.ExpectBegin()
 			mock.ExpectQuery(`SELECT nextval\('locks_rvn'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1))
 			mock.ExpectExec(`INSERT INTO locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
-			mock.ExpectQuery(`SELECT "record_version_number", "data", "owner" FROM locks WHERE name = (.+)`).WillReturnRows(
+			mock.ExpectQuery(`SELECT "record_version_number", "data", "owner", (.+) FROM locks WHERE name = (.+)`).WillReturnRows(
 				sqlmock.NewRows([]string{
 					"record_version_number",
 					"data",
 					"owner",
-				}).AddRow(1, []byte{}, "owner"),
+					"lease_remaining",
+				}).AddRow(1, []byte{}, "owner", 60.0),
 			)
 			mock.ExpectCommit().WillReturnError(badCommit)
 			if _, err := client.Acquire("bad-insert"); !xerrors.Is(err, badCommit) {
@@ -210,12 +211,24 @@ func TestDBErrorHandling(t *testing.T) {
 				t.Errorf("expected delete error missing: %v", err)
 			}
 		})
+		t.Run("bad notify", func(t *testing.T) {
+			client, mock := setup()
+			badNotify := xerrors.New("cannot notify release")
+			mock.ExpectBegin()
+			mock.ExpectExec(`UPDATE locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`DELETE FROM locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`SELECT pg_notify(.+)`).WillReturnError(badNotify)
+			if err := client.Release(fakeLock); !xerrors.Is(err, badNotify) {
+				t.Errorf("expected notify error missing: %v", err)
+			}
+		})
 		t.Run("bad commit", func(t *testing.T) {
 			client, mock := setup()
 			badCommit := xerrors.New("cannot commit release")
 			mock.ExpectBegin()
 			mock.ExpectExec(`UPDATE locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
 			mock.ExpectExec(`DELETE FROM locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+			mock.ExpectExec(`SELECT pg_notify(.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
 			mock.ExpectCommit().WillReturnError(badCommit)
 			if err := client.Release(fakeLock); !xerrors.Is(err, badCommit) {
 				t.Errorf("expected commit error missing: %v", err)
@@ -272,4 +285,364 @@ func TestDBErrorHandling(t *testing.T) {
 			}
 		})
 	})
+	sharedLock := &Lock{
+		leaseDuration: time.Minute,
+		shared:        true,
+	}
+	t.Run("shared", func(t *testing.T) {
+		t.Run("bad exclusive check", func(t *testing.T) {
+			client, mock := setup()
+			badCheck := xerrors.New("cannot check exclusive lock")
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT "owner", (.+) FROM locks WHERE (.+)`).WillReturnError(badCheck)
+			if _, err := client.AcquireShared("bad-check"); !xerrors.Is(err, badCheck) {
+				t.Errorf("expected exclusive check error missing: %v", err)
+			}
+		})
+		t.Run("bad insert", func(t *testing.T) {
+			client, mock := setup()
+			badInsert := xerrors.New("cannot insert")
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT "owner", (.+) FROM locks WHERE (.+)`).WillReturnRows(sqlmock.NewRows([]string{"owner", "lease_remaining"}))
+			mock.ExpectQuery(`SELECT nextval\('locks_rvn'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1))
+			mock.ExpectExec(`DELETE FROM locks_holders (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+			mock.ExpectExec(`INSERT INTO locks_holders (.+)`).WillReturnError(badInsert)
+			if _, err := client.AcquireShared("bad-insert"); !xerrors.Is(err, badInsert) {
+				t.Errorf("expected insert error missing: %v", err)
+			}
+		})
+		t.Run("bad release", func(t *testing.T) {
+			client, mock := setup()
+			badDelete := xerrors.New("cannot delete holder")
+			mock.ExpectBegin()
+			mock.ExpectExec(`DELETE FROM locks_holders (.+)`).WillReturnError(badDelete)
+			if err := client.Release(sharedLock); !xerrors.Is(err, badDelete) {
+				t.Errorf("expected release error missing: %v", err)
+			}
+		})
+		t.Run("bad heartbeat", func(t *testing.T) {
+			client, mock := setup()
+			badUpdate := xerrors.New("cannot update holder")
+			mock.ExpectBegin()
+			mock.ExpectQuery(`SELECT nextval\('locks_rvn'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(1))
+			mock.ExpectExec(`UPDATE locks_holders (.+)`).WillReturnError(badUpdate)
+			if err := client.SendHeartbeat(context.Background(), sharedLock); !xerrors.Is(err, badUpdate) {
+				t.Errorf("expected heartbeat error missing: %v", err)
+			}
+		})
+	})
+}
+
+// setupSQLMock creates a lock client on top of sqlmock, with heartbeats
+// disabled.
+func setupSQLMock(t *testing.T, opts ...ClientOption) (*Client, sqlmock.Sqlmock) {
+	t.Helper()
+	db, mock, err := sqlmock.New()
+	if err != nil {
+		t.Fatal("cannot create mock:", err)
+	}
+	client, err := UnsafeNew(db, append([]ClientOption{WithHeartbeatFrequency(0)}, opts...)...)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	return client, mock
+}
+
+func TestSQLMockAdvisoryLocks(t *testing.T) {
+	t.Run("acquire and release", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"pg_advisory_unlock"}).AddRow(true))
+		mock.ExpectExec(`SELECT pg_notify(.+)`).WithArgs("locks", "advisory").WillReturnResult(sqlmock.NewResult(0, 0))
+		l, err := client.Acquire("advisory")
+		if err != nil {
+			t.Fatal("cannot acquire advisory lock:", err)
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal("cannot release advisory lock:", err)
+		}
+		if !l.IsReleased() {
+			t.Error("advisory lock not marked as released")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("shared", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		mock.ExpectExec(`SELECT pg_advisory_lock_shared\(\$1\)`).WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+		if _, err := client.AcquireShared("advisory"); err != nil {
+			t.Fatal("cannot acquire shared advisory lock:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("fail if locked", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		mock.ExpectQuery(`SELECT pg_try_advisory_lock\(\$1\)`).WithArgs(key).WillReturnRows(sqlmock.NewRows([]string{"pg_try_advisory_lock"}).AddRow(false))
+		if _, err := client.Acquire("advisory", FailIfLocked()); err != ErrNotAcquired {
+			t.Fatal("expected ErrNotAcquired:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("bad release ends the session", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		badUnlock := xerrors.New("cannot unlock")
+		mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT pg_advisory_unlock\(\$1\)`).WithArgs(key).WillReturnError(badUnlock)
+		mock.ExpectExec(`SELECT pg_advisory_unlock_all\(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		l, err := client.Acquire("advisory")
+		if err != nil {
+			t.Fatal("cannot acquire advisory lock:", err)
+		}
+		if err := l.Close(); !xerrors.Is(err, badUnlock) {
+			t.Fatal("expected error not found:", err)
+		}
+		if !l.IsReleased() {
+			t.Error("advisory lock not marked as released")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("bad heartbeat ends the session", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		badPing := xerrors.New("cannot ping")
+		mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(key).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`SELECT 1`).WillReturnError(badPing)
+		mock.ExpectExec(`SELECT pg_advisory_unlock_all\(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		l, err := client.Acquire("advisory")
+		if err != nil {
+			t.Fatal("cannot acquire advisory lock:", err)
+		}
+		if err := client.SendHeartbeat(context.Background(), l); !xerrors.Is(err, badPing) {
+			t.Fatal("expected error not found:", err)
+		}
+		if !l.IsReleased() {
+			t.Error("advisory lock not marked as released")
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("bad acquire ends the session", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		key := client.advisoryKey("advisory")
+		badLock := xerrors.New("canceling statement due to user request")
+		mock.ExpectExec(`SELECT pg_advisory_lock\(\$1\)`).WithArgs(key).WillReturnError(badLock)
+		mock.ExpectExec(`SELECT pg_advisory_unlock_all\(\)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		if _, err := client.Acquire("advisory"); !xerrors.Is(err, badLock) {
+			t.Fatal("expected error not found:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("unsupported operations", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithAdvisoryLocks())
+		ctx := context.Background()
+		for _, opt := range []LockOption{WithData([]byte("data")), ReplaceData(), KeepOnRelease()} {
+			if _, err := client.Acquire("advisory", opt); err != ErrNotSupportedWithAdvisoryLocks {
+				t.Error("expected ErrNotSupportedWithAdvisoryLocks on acquire:", err)
+			}
+			if _, err := client.AcquireSemaphore(ctx, "advisory", 1, opt); err != ErrNotSupportedWithAdvisoryLocks {
+				t.Error("expected ErrNotSupportedWithAdvisoryLocks on semaphore:", err)
+			}
+		}
+		if _, err := client.Get("advisory"); err != ErrNotSupportedWithAdvisoryLocks {
+			t.Error("expected ErrNotSupportedWithAdvisoryLocks on get:", err)
+		}
+		if _, err := client.GetData("advisory"); err != ErrNotSupportedWithAdvisoryLocks {
+			t.Error("expected ErrNotSupportedWithAdvisoryLocks on get data:", err)
+		}
+		if _, err := client.List(ctx); err != ErrNotSupportedWithAdvisoryLocks {
+			t.Error("expected ErrNotSupportedWithAdvisoryLocks on list:", err)
+		}
+		if err := client.ForceRelease(ctx, "advisory"); err != ErrNotSupportedWithAdvisoryLocks {
+			t.Error("expected ErrNotSupportedWithAdvisoryLocks on force release:", err)
+		}
+		if _, err := client.History(ctx, "advisory"); err != ErrNotSupportedWithAdvisoryLocks {
+			t.Error("expected ErrNotSupportedWithAdvisoryLocks on history:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("namespaced keys", func(t *testing.T) {
+		client, _ := setupSQLMock(t, WithAdvisoryLocks())
+		other, _ := UnsafeNew(client.db, WithCustomTable("other"), WithAdvisoryLocks())
+		if client.advisoryKey("advisory") == other.advisoryKey("advisory") {
+			t.Error("advisory keys must depend on the table name")
+		}
+	})
+}
+
+func TestSQLMockListAndForceRelease(t *testing.T) {
+	t.Run("list", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		mock.ExpectQuery(`SELECT (.+) FROM locks ORDER BY "name"`).WillReturnRows(
+			sqlmock.NewRows([]string{
+				"name", "owner", "record_version_number", "data_size", "held", "lease_remaining",
+				"owner_hostname", "owner_pid", "acquired_at", "last_heartbeat_at",
+			}).
+				AddRow("held", "owner-1", 10, 3, true, 60.0, "host-1", 42, time.Now(), time.Now()).
+				AddRow("released", "owner-2", nil, 0, false, nil, nil, nil, nil, nil),
+		)
+		locks, err := client.List(context.Background())
+		if err != nil {
+			t.Fatal("cannot list locks:", err)
+		}
+		if len(locks) != 2 {
+			t.Fatal("unexpected number of locks:", len(locks))
+		}
+		held, released := locks[0], locks[1]
+		if held.Name != "held" || held.Owner != "owner-1" || held.RecordVersionNumber != 10 ||
+			held.DataSize != 3 || !held.IsHeld || held.ExpiresAt.IsZero() ||
+			held.OwnerHostname != "host-1" || held.OwnerPID != 42 || held.AcquiredAt.IsZero() || held.LastHeartbeatAt.IsZero() {
+			t.Errorf("unexpected held lock: %+v", held)
+		}
+		if released.Name != "released" || released.RecordVersionNumber != 0 ||
+			released.IsHeld || !released.ExpiresAt.IsZero() {
+			t.Errorf("unexpected released lock: %+v", released)
+		}
+	})
+	t.Run("force release", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM locks WHERE (.+)`).WithArgs("stuck").WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectExec(`DELETE FROM locks_holders WHERE (.+)`).WithArgs("stuck").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`SELECT pg_notify(.+)`).WithArgs("locks", "stuck").WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		if err := client.ForceRelease(context.Background(), "stuck"); err != nil {
+			t.Fatal("cannot force release:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("force release missing lock", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`DELETE FROM locks WHERE (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`DELETE FROM locks_holders WHERE (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		if err := client.ForceRelease(context.Background(), "missing"); err != ErrLockNotFound {
+			t.Fatal("expected ErrLockNotFound:", err)
+		}
+	})
+}
+
+func TestSQLMockMigrate(t *testing.T) {
+	t.Run("upgrade", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT "attname" FROM pg_attribute (.+)`).WithArgs("locks").WillReturnRows(
+			sqlmock.NewRows([]string{"attname"}).AddRow("name").AddRow("record_version_number").AddRow("data").AddRow("owner"),
+		)
+		for _, col := range lockTableColumns[4:] {
+			mock.ExpectExec(`ALTER TABLE locks ADD COLUMN ` + col.name + ` (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		}
+		mock.ExpectExec(`CREATE SEQUENCE IF NOT EXISTS locks_rvn (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS locks_holders (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		if err := client.Migrate(context.Background()); err != nil {
+			t.Fatal("cannot migrate:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("missing table", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT "attname" FROM pg_attribute (.+)`).WillReturnRows(sqlmock.NewRows([]string{"attname"}))
+		mock.ExpectExec(`CREATE TABLE locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE SEQUENCE IF NOT EXISTS locks_rvn (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS locks_holders (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		if err := client.Migrate(context.Background()); err != nil {
+			t.Fatal("cannot migrate:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("up to date", func(t *testing.T) {
+		client, mock := setupSQLMock(t)
+		rows := sqlmock.NewRows([]string{"attname"})
+		for _, col := range lockTableColumns {
+			rows.AddRow(col.name)
+		}
+		mock.ExpectBegin()
+		mock.ExpectExec(`SELECT pg_advisory_xact_lock(.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectQuery(`SELECT "attname" FROM pg_attribute (.+)`).WillReturnRows(rows)
+		mock.ExpectExec(`CREATE SEQUENCE IF NOT EXISTS locks_rvn (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectExec(`CREATE TABLE IF NOT EXISTS locks_holders (.+)`).WillReturnResult(sqlmock.NewResult(0, 0))
+		mock.ExpectCommit()
+		if err := client.Migrate(context.Background()); err != nil {
+			t.Fatal("cannot migrate:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+}
+
+func TestSQLMockHistory(t *testing.T) {
+	t.Run("steal", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithOwner("owner"), WithHistory())
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT nextval\('locks_rvn'\)`).WillReturnRows(sqlmock.NewRows([]string{"nextval"}).AddRow(2))
+		mock.ExpectQuery(`SELECT "owner" FROM locks WHERE (.+)`).WithArgs("stolen").WillReturnRows(sqlmock.NewRows([]string{"owner"}).AddRow("crashed"))
+		mock.ExpectExec(`INSERT INTO locks (.+)`).WillReturnResult(sqlmock.NewResult(0, 1))
+		mock.ExpectQuery(`SELECT "record_version_number", "data", "owner", (.+) FROM locks WHERE name = (.+)`).WillReturnRows(
+			sqlmock.NewRows([]string{"record_version_number", "data", "owner", "lease_remaining"}).AddRow(2, []byte{}, "owner", 60.0),
+		)
+		mock.ExpectExec(`INSERT INTO locks_history (.+)`).
+			WithArgs("stolen", "steal", "owner", client.hostname, client.pid, 2, "crashed").
+			WillReturnResult(sqlmock.NewResult(1, 1))
+		mock.ExpectCommit()
+		mock.ExpectBegin()
+		mock.ExpectQuery(`SELECT (.+) FROM locks_holders (.+)`).WillReturnRows(sqlmock.NewRows([]string{"lease_remaining"}).AddRow(nil))
+		mock.ExpectCommit()
+		if _, err := client.Acquire("stolen"); err != nil {
+			t.Fatal("cannot acquire lock:", err)
+		}
+		if err := mock.ExpectationsWereMet(); err != nil {
+			t.Error(err)
+		}
+	})
+	t.Run("load", func(t *testing.T) {
+		client, mock := setupSQLMock(t, WithOwner("owner"), WithHistory())
+		mock.ExpectQuery(`SELECT (.+) FROM locks_history WHERE "name" = (.+) ORDER BY "id"`).WithArgs("lock").WillReturnRows(
+			sqlmock.NewRows([]string{"event", "owner", "owner_hostname", "owner_pid", "record_version_number", "previous_owner", "created_at"}).
+				AddRow("acquire", "owner", "host", 42, 1, nil, time.Now()).
+				AddRow("release", "owner", "host", 42, 1, nil, time.Now()),
+		)
+		entries, err := client.History(context.Background(), "lock")
+		if err != nil {
+			t.Fatal("cannot load history:", err)
+		}
+		if len(entries) != 2 || entries[0].Event != HistoryAcquire || entries[1].Event != HistoryRelease {
+			t.Fatalf("unexpected history: %+v", entries)
+		}
+		if e := entries[0]; e.Owner != "owner" || e.OwnerHostname != "host" || e.OwnerPID != 42 || e.RecordVersionNumber != 1 || e.CreatedAt.IsZero() {
+			t.Errorf("unexpected history entry: %+v", e)
+		}
+	})
+	t.Run("disabled", func(t *testing.T) {
+		client, _ := setupSQLMock(t, WithOwner("owner"))
+		if _, err := client.History(context.Background(), "lock"); err != ErrHistoryDisabled {
+			t.Fatal("expected ErrHistoryDisabled:", err)
+		}
+	})
 }
@@ -437,7 +437,7 @@ func TestCustomTable(t *testing.T) {
 	t.Run("happy path", func(t *testing.T) {
 		tableName := randStr(32)
 		defer func() {
-			db.Exec("DROP TABLE " + tableName)
+			db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders")
 		}()
 		name := randStr(32)
 		c, err := pglock.New(
@@ -461,7 +461,7 @@ func TestCustomTable(t *testing.T) {
 	t.Run("duplicated call", func(t *testing.T) {
 		tableName := randStr(32)
 		defer func() {
-			db.Exec("DROP TABLE " + tableName)
+			db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders")
 		}()
 		c, err := pglock.New(
 			db,
@@ -822,3 +822,459 @@ func TestReleaseLostLock(t *testing.T) {
 	}
 	t.Log(c.Release(l))
 }
+
+func TestListener(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	name := randStr(32)
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithLeaseDuration(time.Minute),
+		pglock.WithHeartbeatFrequency(time.Second),
+		pglock.WithListener(*dsn),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	defer c.Close()
+	l, err := c.Acquire(name)
+	if err != nil {
+		t.Fatal("unexpected error while acquiring lock:", err)
+	}
+	t.Log("first lock acquired")
+	acquired := make(chan error, 1)
+	go func() {
+		l, err := c.Acquire(name)
+		if err == nil {
+			err = l.Close()
+		}
+		acquired <- err
+	}()
+	time.Sleep(time.Second)
+	if err := l.Close(); err != nil {
+		t.Fatal("cannot release first lock:", err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal("unexpected error while acquiring released lock:", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("waiter not woken up by the lock release")
+	}
+}
+
+func TestLeaseExpiry(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	name := randStr(32)
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithLeaseDuration(2*time.Second),
+		pglock.WithHeartbeatFrequency(0),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	l, err := c.Acquire(name)
+	if err != nil {
+		t.Fatal("unexpected error while acquiring lock:", err)
+	}
+	if remaining := time.Until(l.ExpiresAt()); remaining <= 0 || remaining > 2*time.Second {
+		t.Fatal("unexpected lease expiry:", l.ExpiresAt(), remaining)
+	}
+	if err := c.SendHeartbeat(context.Background(), l); err != nil {
+		t.Fatal("cannot send heartbeat:", err)
+	}
+	if _, err := c.Acquire(name, pglock.FailIfLocked()); err != pglock.ErrNotAcquired {
+		t.Fatal("live lease must not be stolen:", err)
+	}
+	time.Sleep(time.Until(l.ExpiresAt()) + 500*time.Millisecond)
+	l2, err := c.Acquire(name, pglock.FailIfLocked())
+	if err != nil {
+		t.Fatal("expired lease should have been stolen:", err)
+	}
+	defer l2.Close()
+	if err := c.SendHeartbeat(context.Background(), l); !xerrors.Is(err, pglock.ErrLockAlreadyReleased) {
+		t.Fatal("the stolen lock should be lost:", err)
+	}
+}
+
+func TestSharedLocks(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	tableName := randStr(32)
+	defer func() {
+		db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders")
+	}()
+	name := randStr(32)
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithCustomTable(tableName),
+		pglock.WithLeaseDuration(5*time.Second),
+		pglock.WithHeartbeatFrequency(time.Second),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	if err := c.CreateTable(); err != nil {
+		t.Fatal("cannot create table:", err)
+	}
+	r1, err := c.AcquireShared(name)
+	if err != nil {
+		t.Fatal("cannot acquire first shared lock:", err)
+	}
+	r2, err := c.AcquireShared(name, pglock.FailIfLocked())
+	if err != nil {
+		t.Fatal("cannot acquire second shared lock:", err)
+	}
+	if !r1.IsShared() || !r2.IsShared() {
+		t.Fatal("shared locks not marked as such")
+	}
+	if _, err := c.Acquire(name, pglock.FailIfLocked()); err != pglock.ErrNotAcquired {
+		t.Fatal("exclusive lock must not be granted while shared locks are held:", err)
+	}
+	acquired := make(chan error, 1)
+	go func() {
+		w, err := c.Acquire(name)
+		if err != nil {
+			acquired <- err
+			return
+		}
+		if _, err := c.AcquireShared(name, pglock.FailIfLocked()); err != pglock.ErrNotAcquired {
+			acquired <- xerrors.Errorf("shared lock granted while exclusive lock is held: %w", err)
+			return
+		}
+		acquired <- w.Close()
+	}()
+	time.Sleep(time.Second)
+	select {
+	case err := <-acquired:
+		t.Fatal("exclusive lock granted while shared locks are held:", err)
+	default:
+	}
+	if err := r1.Close(); err != nil {
+		t.Fatal("cannot release first shared lock:", err)
+	}
+	if err := r2.Close(); err != nil {
+		t.Fatal("cannot release second shared lock:", err)
+	}
+	select {
+	case err := <-acquired:
+		if err != nil {
+			t.Fatal("unexpected error on exclusive lock:", err)
+		}
+	case <-time.After(30 * time.Second):
+		t.Fatal("exclusive lock not granted after shared locks were released")
+	}
+}
+
+func TestSemaphore(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithLeaseDuration(5*time.Second),
+		pglock.WithHeartbeatFrequency(time.Second),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	ctx := context.Background()
+	t.Run("no permits", func(t *testing.T) {
+		if _, err := c.AcquireSemaphore(ctx, randStr(32), 0); err != pglock.ErrNoPermits {
+			t.Fatal("expected ErrNoPermits:", err)
+		}
+	})
+	t.Run("reserved names", func(t *testing.T) {
+		name := "pglock.semaphore#" + randStr(32) + "#0"
+		if _, err := c.Acquire(name); err != pglock.ErrReservedName {
+			t.Fatal("expected ErrReservedName on acquire:", err)
+		}
+		if _, err := c.AcquireShared(name); err != pglock.ErrReservedName {
+			t.Fatal("expected ErrReservedName on shared acquire:", err)
+		}
+	})
+	t.Run("happy path", func(t *testing.T) {
+		name := randStr(32)
+		p1, err := c.AcquireSemaphore(ctx, name, 2)
+		if err != nil {
+			t.Fatal("cannot acquire first permit:", err)
+		}
+		p2, err := c.AcquireSemaphore(ctx, name, 2)
+		if err != nil {
+			t.Fatal("cannot acquire second permit:", err)
+		}
+		defer p2.Close()
+		if l, err := c.AcquireSemaphore(ctx, name, 2, pglock.FailIfLocked()); err != pglock.ErrNotAcquired || l == nil {
+			t.Fatal("expected ErrNotAcquired and the last permit tried when all permits are taken:", l, err)
+		}
+		if err := p1.Close(); err != nil {
+			t.Fatal("cannot release first permit:", err)
+		}
+		p3, err := c.AcquireSemaphore(ctx, name, 2, pglock.FailIfLocked())
+		if err != nil {
+			t.Fatal("cannot acquire released permit:", err)
+		}
+		defer p3.Close()
+	})
+}
+
+func TestAdvisoryLocks(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	name := randStr(32)
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithAdvisoryLocks(),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	l, err := c.Acquire(name)
+	if err != nil {
+		t.Fatal("cannot acquire advisory lock:", err)
+	}
+	if _, err := c.Acquire(name, pglock.FailIfLocked()); err != pglock.ErrNotAcquired {
+		t.Fatal("expected ErrNotAcquired:", err)
+	}
+	err = c.Do(context.Background(), randStr(32), func(ctx context.Context, l *pglock.Lock) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal("cannot run Do with advisory lock:", err)
+	}
+	if err := l.Close(); err != nil {
+		t.Fatal("cannot release advisory lock:", err)
+	}
+	l2, err := c.Acquire(name, pglock.FailIfLocked())
+	if err != nil {
+		t.Fatal("cannot acquire released advisory lock:", err)
+	}
+	if err := l2.Close(); err != nil {
+		t.Fatal("cannot release advisory lock:", err)
+	}
+}
+
+func TestListAndForceRelease(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	name := randStr(32)
+	c, err := pglock.New(
+		db,
+		pglock.WithLogger(&testLogger{t}),
+		pglock.WithLeaseDuration(5*time.Second),
+		pglock.WithHeartbeatFrequency(time.Second),
+	)
+	if err != nil {
+		t.Fatal("cannot create lock client:", err)
+	}
+	ctx := context.Background()
+	l, err := c.Acquire(name, pglock.WithData([]byte("data")))
+	if err != nil {
+		t.Fatal("cannot acquire lock:", err)
+	}
+	locks, err := c.List(ctx)
+	if err != nil {
+		t.Fatal("cannot list locks:", err)
+	}
+	var found *pglock.LockInfo
+	for _, info := range locks {
+		if info.Name == name {
+			found = info
+		}
+	}
+	if found == nil {
+		t.Fatal("lock not listed")
+	}
+	if !found.IsHeld || found.Owner != l.Owner() || found.RecordVersionNumber == 0 || found.DataSize != 4 {
+		t.Fatalf("unexpected lock information: %+v", found)
+	}
+	if err := c.ForceRelease(ctx, name); err != nil {
+		t.Fatal("cannot force release:", err)
+	}
+	if _, err := c.Acquire(name, pglock.FailIfLocked()); err != nil {
+		t.Fatal("cannot acquire forcefully released lock:", err)
+	}
+	if err := c.ForceRelease(ctx, randStr(32)); err != pglock.ErrLockNotFound {
+		t.Fatal("expected ErrLockNotFound:", err)
+	}
+}
+
+func TestMigrate(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	ctx := context.Background()
+	newClient := func(t *testing.T, tableName string) *pglock.Client {
+		c, err := pglock.New(
+			db,
+			pglock.WithLogger(&testLogger{t}),
+			pglock.WithCustomTable(tableName),
+			pglock.WithLeaseDuration(5*time.Second),
+			pglock.WithHeartbeatFrequency(time.Second),
+		)
+		if err != nil {
+			t.Fatal("cannot create lock client:", err)
+		}
+		return c
+	}
+	checkLocks := func(t *testing.T, c *pglock.Client) {
+		name := randStr(32)
+		l, err := c.Acquire(name)
+		if err != nil {
+			t.Fatal("cannot acquire lock after migration:", err)
+		}
+		if l.ExpiresAt().IsZero() {
+			t.Error("lease expiry missing after migration")
+		}
+		if err := l.Close(); err != nil {
+			t.Fatal("cannot release lock after migration:", err)
+		}
+		s, err := c.AcquireShared(name)
+		if err != nil {
+			t.Fatal("cannot acquire shared lock after migration:", err)
+		}
+		if err := s.Close(); err != nil {
+			t.Fatal("cannot release shared lock after migration:", err)
+		}
+	}
+	t.Run("upgrade", func(t *testing.T) {
+		tableName := randStr(32)
+		defer func() {
+			db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders")
+		}()
+		// DDL of the lock tables created before Migrate was introduced.
+		cmds := []string{
+			`CREATE TABLE ` + tableName + ` (
+				name CHARACTER VARYING(255) PRIMARY KEY,
+				record_version_number BIGINT,
+				data BYTEA,
+				owner CHARACTER VARYING(255)
+			);`,
+			`CREATE SEQUENCE ` + tableName + `_rvn OWNED BY ` + tableName + `.record_version_number`,
+			`INSERT INTO ` + tableName + ` (name, record_version_number, data, owner) VALUES ('legacy', NULL, 'data', 'owner')`,
+		}
+		for _, cmd := range cmds {
+			if _, err := db.Exec(cmd); err != nil {
+				t.Fatal("cannot prepare legacy table:", err)
+			}
+		}
+		c := newClient(t, tableName)
+		for i := 0; i < 2; i++ {
+			if err := c.Migrate(ctx); err != nil {
+				t.Fatal("cannot migrate table:", err)
+			}
+		}
+		data, err := c.GetData("legacy")
+		if err != nil {
+			t.Fatal("cannot read legacy lock:", err)
+		}
+		if !bytes.Equal(data, []byte("data")) {
+			t.Errorf("legacy lock data lost: %q", data)
+		}
+		checkLocks(t, c)
+	})
+	t.Run("missing table", func(t *testing.T) {
+		tableName := randStr(32)
+		defer func() {
+			db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders")
+		}()
+		c := newClient(t, tableName)
+		if err := c.Migrate(ctx); err != nil {
+			t.Fatal("cannot migrate table:", err)
+		}
+		if err := c.Migrate(ctx); err != nil {
+			t.Fatal("cannot migrate table twice:", err)
+		}
+		checkLocks(t, c)
+	})
+}
+
+func TestHistory(t *testing.T) {
+	t.Parallel()
+	db := setupDB(t)
+	defer db.Close()
+	tableName := randStr(32)
+	defer func() {
+		db.Exec("DROP TABLE " + tableName + ", " + tableName + "_holders, " + tableName + "_history")
+	}()
+	newClient := func(owner string) *pglock.Client {
+		c, err := pglock.New(
+			db,
+			pglock.WithLogger(&testLogger{t}),
+			pglock.WithCustomTable(tableName),
+			pglock.WithLeaseDuration(time.Second),
+			pglock.WithHeartbeatFrequency(0),
+			pglock.WithOwner(owner),
+			pglock.WithHistory(),
+		)
+		if err != nil {
+			t.Fatal("cannot create lock client:", err)
+		}
+		return c
+	}
+	ctx := context.Background()
+	c1, c2 := newClient("first"), newClient("second")
+	if err := c1.CreateTable(); err != nil {
+		t.Fatal("cannot create table:", err)
+	}
+	name := randStr(32)
+	l1, err := c1.Acquire(name)
+	if err != nil {
+		t.Fatal("cannot acquire lock:", err)
+	}
+	locks, err := c1.List(ctx)
+	if err != nil || len(locks) != 1 {
+		t.Fatal("cannot list locks:", locks, err)
+	}
+	if info := locks[0]; info.OwnerHostname == "" || info.OwnerPID == 0 || info.AcquiredAt.IsZero() || info.LastHeartbeatAt.IsZero() {
+		t.Errorf("owner metadata missing: %+v", info)
+	}
+	time.Sleep(time.Until(l1.ExpiresAt()) + 500*time.Millisecond)
+	l2, err := c2.Acquire(name, pglock.FailIfLocked())
+	if err != nil {
+		t.Fatal("cannot steal expired lock:", err)
+	}
+	if err := c1.SendHeartbeat(ctx, l1); !xerrors.Is(err, pglock.ErrLockAlreadyReleased) {
+		t.Fatal("the stolen lock should be lost:", err)
+	}
+	if err := l2.Close(); err != nil {
+		t.Fatal("cannot release lock:", err)
+	}
+	history, err := c1.History(ctx, name)
+	if err != nil {
+		t.Fatal("cannot load history:", err)
+	}
+	expected := []struct {
+		event pglock.HistoryEvent
+		owner string
+	}{
+		{pglock.HistoryAcquire, "first"},
+		{pglock.HistorySteal, "second"},
+		{pglock.HistoryHeartbeatLost, "first"},
+		{pglock.HistoryRelease, "second"},
+	}
+	if len(history) != len(expected) {
+		t.Fatalf("unexpected history length: %d", len(history))
+	}
+	for i, e := range expected {
+		if history[i].Event != e.event || history[i].Owner != e.owner {
+			t.Errorf("unexpected history entry %d: %+v", i, history[i])
+		}
+	}
+	if history[1].PreviousOwner != "first" {
+		t.Error("steal must record the previous owner:", history[1].PreviousOwner)
+	}
+}
@@ -0,0 +1,137 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+// Command pglock inspects and manages the locks table of cirello.io/pglock.
+//
+// Usage:
+//
+//	pglock [-dsn connection-string] [-table locks] command [lock-name]
+//
+// Commands:
+//
+//	list          list the locks in the table
+//	get           show the details of a lock
+//	release       delete a lock regardless of its owner
+//	create-table  create the locks table
+//
+// The connection string defaults to the content of the DATABASE_URL
+// environment variable.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"text/tabwriter"
+	"time"
+
+	"cirello.io/pglock"
+	_ "github.com/lib/pq"
+	"golang.org/x/xerrors"
+)
+
+func main() {
+	log.SetPrefix("pglock: ")
+	log.SetFlags(0)
+	dsn := flag.String("dsn", os.Getenv("DATABASE_URL"), "connection string to the database server")
+	table := flag.String("table", pglock.DefaultTableName, "name of the locks table")
+	flag.Usage = func() {
+		fmt.Fprintln(flag.CommandLine.Output(), "usage: pglock [flags] list|get|release|create-table [lock-name]")
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+	if flag.NArg() == 0 {
+		flag.Usage()
+		os.Exit(2)
+	}
+	if err := run(*dsn, *table, flag.Arg(0), flag.Arg(1)); err != nil {
+		log.Fatal(err)
+	}
+}
+
+func run(dsn, table, cmd, lockName string) error {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return xerrors.Errorf("cannot connect to database server: %w", err)
+	}
+	defer db.Close()
+	c, err := pglock.New(db, pglock.WithCustomTable(table))
+	if err != nil {
+		return xerrors.Errorf("cannot create lock client: %w", err)
+	}
+	ctx := context.Background()
+	switch cmd {
+	case "list":
+		return list(ctx, c)
+	case "get":
+		if lockName == "" {
+			return xerrors.New("missing lock name")
+		}
+		return get(ctx, c, lockName)
+	case "release":
+		if lockName == "" {
+			return xerrors.New("missing lock name")
+		}
+		if err := c.ForceRelease(ctx, lockName); err != nil {
+			return xerrors.Errorf("cannot release lock: %w", err)
+		}
+		return nil
+	case "create-table":
+		if err := c.CreateTable(); err != nil {
+			return xerrors.Errorf("cannot create table: %w", err)
+		}
+		return nil
+	default:
+		return xerrors.Errorf("unknown command %q", cmd)
+	}
+}
+
+func list(ctx context.Context, c *pglock.Client) error {
+	locks, err := c.List(ctx)
+	if err != nil {
+		return xerrors.Errorf("cannot list locks: %w", err)
+	}
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "NAME\tOWNER\tHOST\tPID\tRVN\tDATA SIZE\tHELD\tACQUIRED AT\tLAST HEARTBEAT\tEXPIRES AT")
+	for _, l := range locks {
+		fmt.Fprintf(w, "%s\t%s\t%s\t%d\t%d\t%d\t%t\t%s\t%s\t%s\n", l.Name, l.Owner,
+			l.OwnerHostname, l.OwnerPID, l.RecordVersionNumber, l.DataSize, l.IsHeld,
+			formatTime(l.AcquiredAt), formatTime(l.LastHeartbeatAt), formatTime(l.ExpiresAt))
+	}
+	return w.Flush()
+}
+
+func get(ctx context.Context, c *pglock.Client, lockName string) error {
+	l, err := c.GetContext(ctx, lockName)
+	if err != nil {
+		return xerrors.Errorf("cannot get lock: %w", err)
+	}
+	fmt.Println("name:", lockName)
+	fmt.Println("owner:", l.Owner())
+	fmt.Println("expires at:", formatTime(l.ExpiresAt()))
+	fmt.Printf("data: %q\n", l.Data())
+	return nil
+}
+
+func formatTime(t time.Time) string {
+	if t.IsZero() {
+		return "-"
+	}
+	return t.Format(time.RFC3339)
+}
@@ -95,9 +95,20 @@ var ErrLockAlreadyReleased = xerrors.New("lock is already released")
 // ErrLockNotFound is returned for get calls on missing lock entries.
 var ErrLockNotFound = &NotExistError{xerrors.New("lock not found")}
 
+// ErrNotSupportedWithAdvisoryLocks is returned by the operations and lock
+// options that need the lock table, when the client is configured
+// WithAdvisoryLocks.
+var ErrNotSupportedWithAdvisoryLocks = xerrors.New("not supported with advisory locks")
+
+// ErrHistoryDisabled is returned by History when the client is not configured
+// WithHistory.
+var ErrHistoryDisabled = xerrors.New("lock history is disabled")
+
 // Validation errors
 var (
 	ErrDurationTooSmall = xerrors.New("Heartbeat period must be no more than half the length of the Lease Duration, " +
 		"or locks might expire due to the heartbeat thread taking too long to update them (recommendation is to make it much greater, for example " +
 		"4+ times greater)")
+	ErrNoPermits    = xerrors.New("semaphore must have at least one permit")
+	ErrReservedName = xerrors.New("lock name uses the prefix reserved for semaphore permits: " + permitNamePrefix)
 )
@@ -0,0 +1,177 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// HistoryEvent is the kind of an entry in the lock history.
+type HistoryEvent string
+
+// Events recorded in the lock history.
+const (
+	// HistoryAcquire is recorded when a free lock is acquired.
+	HistoryAcquire HistoryEvent = "acquire"
+
+	// HistorySteal is recorded when a lock is acquired after the lease of
+	// its previous owner expired.
+	HistorySteal HistoryEvent = "steal"
+
+	// HistoryHeartbeatLost is recorded when a heartbeat finds out that the
+	// lock is no longer held by its owner.
+	HistoryHeartbeatLost HistoryEvent = "heartbeat-lost"
+
+	// HistoryRelease is recorded when the owner releases the lock.
+	HistoryRelease HistoryEvent = "release"
+
+	// HistoryForceRelease is recorded when a lock is deleted with
+	// ForceRelease.
+	HistoryForceRelease HistoryEvent = "force-release"
+)
+
+// HistoryEntry is an event in the history of a lock.
+type HistoryEntry struct {
+	Event HistoryEvent
+
+	// Owner, OwnerHostname and OwnerPID identify the client that caused
+	// the event.
+	Owner         string
+	OwnerHostname string
+	OwnerPID      int
+
+	RecordVersionNumber int64
+
+	// PreviousOwner is the owner whose lease expired, for HistorySteal
+	// events.
+	PreviousOwner string
+
+	// CreatedAt is kept by the database clock.
+	CreatedAt time.Time
+}
+
+// WithHistory makes the client record the acquisitions, steals, lost
+// heartbeats and releases of exclusive locks in an append-only table named
+// after the lock table, with the "_history" suffix. The table is created by
+// CreateTable and Migrate. Events are recorded in the same transaction that
+// changes the lock, and can be read with History.
+func WithHistory() ClientOption {
+	return func(c *Client) { c.history = true }
+}
+
+func (c *Client) historyTableName() string {
+	return c.tableName + "_history"
+}
+
+func (c *Client) recordHistory(ctx context.Context, tx *sql.Tx, event HistoryEvent, name string, rvn int64, previousOwner string) error {
+	if !c.history {
+		return nil
+	}
+	_, err := tx.ExecContext(ctx, `
+		INSERT INTO `+c.historyTableName()+`
+			("name", "event", "owner", "owner_hostname", "owner_pid",
+			"record_version_number", "previous_owner")
+		VALUES
+			($1, $2, $3, $4, $5, NULLIF($6, 0), NULLIF($7, ''))
+	`, name, string(event), c.owner, c.hostname, c.pid, rvn, previousOwner)
+	return typedError(err, "cannot run query to record lock history")
+}
+
+// recordLostHeartbeat commits the history of a heartbeat that found out the
+// lock was lost. Failures are only logged, as the lock is gone anyway.
+func (c *Client) recordLostHeartbeat(ctx context.Context, tx *sql.Tx, l *Lock) {
+	if !c.history {
+		return
+	}
+	err := c.recordHistory(ctx, tx, HistoryHeartbeatLost, l.name, l.recordVersionNumber, "")
+	if err == nil {
+		err = tx.Commit()
+	}
+	if err != nil {
+		c.log.Println("cannot record lost heartbeat:", l.name, err)
+	}
+}
+
+// History returns the recorded events of the named lock, oldest first. The
+// client must be configured WithHistory.
+func (c *Client) History(ctx context.Context, name string) ([]*HistoryEntry, error) {
+	if c.advisory {
+		return nil, ErrNotSupportedWithAdvisoryLocks
+	}
+	var entries []*HistoryEntry
+	err := c.retry(func() error {
+		var err error
+		entries, err = c.loadHistory(ctx, name)
+		return err
+	})
+	return entries, err
+}
+
+func (c *Client) loadHistory(ctx context.Context, name string) ([]*HistoryEntry, error) {
+	if !c.history {
+		return nil, ErrHistoryDisabled
+	}
+	ctx, cancel := context.WithTimeout(ctx, c.leaseDuration)
+	defer cancel()
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT
+			"event",
+			"owner",
+			"owner_hostname",
+			"owner_pid",
+			"record_version_number",
+			"previous_owner",
+			"created_at"
+		FROM
+			`+c.historyTableName()+`
+		WHERE
+			"name" = $1
+		ORDER BY
+			"id"
+	`, name)
+	if err != nil {
+		return nil, typedError(err, "cannot run query to load lock history")
+	}
+	defer rows.Close()
+	var entries []*HistoryEntry
+	for rows.Next() {
+		var (
+			e             HistoryEntry
+			owner         sql.NullString
+			hostname      sql.NullString
+			pid           sql.NullInt64
+			rvn           sql.NullInt64
+			previousOwner sql.NullString
+		)
+		err := rows.Scan(&e.Event, &owner, &hostname, &pid, &rvn, &previousOwner, &e.CreatedAt)
+		if err != nil {
+			return nil, typedError(err, "cannot load the lock history entry")
+		}
+		e.Owner = owner.String
+		e.OwnerHostname = hostname.String
+		e.OwnerPID = int(pid.Int64)
+		e.RecordVersionNumber = rvn.Int64
+		e.PreviousOwner = previousOwner.String
+		entries = append(entries, &e)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, typedError(err, "cannot load lock history")
+	}
+	return entries, nil
+}
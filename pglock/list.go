@@ -0,0 +1,171 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// LockInfo describes a lock entry in the table, as returned by List.
+type LockInfo struct {
+	Name  string
+	Owner string
+
+	// RecordVersionNumber is zero for released locks.
+	RecordVersionNumber int64
+
+	// DataSize is the size in bytes of the data stored in the lock.
+	DataSize int
+
+	// IsHeld tells whether the lock is currently held, that is, it is
+	// neither released nor expired.
+	IsHeld bool
+
+	// ExpiresAt is when the lease of the lock expires, translated to the
+	// local clock. It is zero for released locks and for entries written
+	// by older versions of this package.
+	ExpiresAt time.Time
+
+	// OwnerHostname and OwnerPID identify the process of the owner.
+	OwnerHostname string
+	OwnerPID      int
+
+	// AcquiredAt and LastHeartbeatAt are kept by the database clock. They
+	// are zero for entries written by older versions of this package.
+	AcquiredAt      time.Time
+	LastHeartbeatAt time.Time
+}
+
+// List returns every lock entry in the table, sorted by name. Shared locks
+// are not listed.
+func (c *Client) List(ctx context.Context) ([]*LockInfo, error) {
+	if c.advisory {
+		return nil, ErrNotSupportedWithAdvisoryLocks
+	}
+	var locks []*LockInfo
+	err := c.retry(func() error {
+		var err error
+		locks, err = c.listLocks(ctx)
+		return err
+	})
+	return locks, err
+}
+
+func (c *Client) listLocks(ctx context.Context) ([]*LockInfo, error) {
+	ctx, cancel := context.WithTimeout(ctx, c.leaseDuration)
+	defer cancel()
+	start := time.Now()
+	rows, err := c.db.QueryContext(ctx, `
+		SELECT
+			"name",
+			"owner",
+			"record_version_number",
+			COALESCE(octet_length("data"), 0),
+			"record_version_number" IS NOT NULL
+				AND ("lease_expires_at" IS NULL OR "lease_expires_at" >= now()),
+			`+leaseRemainingColumn+`,
+			"owner_hostname",
+			"owner_pid",
+			"acquired_at",
+			"last_heartbeat_at"
+		FROM
+			`+c.tableName+`
+		ORDER BY
+			"name"
+	`)
+	if err != nil {
+		return nil, typedError(err, "cannot run query to list locks")
+	}
+	defer rows.Close()
+	var locks []*LockInfo
+	for rows.Next() {
+		var (
+			l              LockInfo
+			owner          sql.NullString
+			rvn            sql.NullInt64
+			leaseRemaining sql.NullFloat64
+			hostname       sql.NullString
+			pid            sql.NullInt64
+			acquiredAt     sql.NullTime
+			heartbeatAt    sql.NullTime
+		)
+		err := rows.Scan(&l.Name, &owner, &rvn, &l.DataSize, &l.IsHeld, &leaseRemaining,
+			&hostname, &pid, &acquiredAt, &heartbeatAt)
+		if err != nil {
+			return nil, typedError(err, "cannot load the information of this lock")
+		}
+		l.Owner = owner.String
+		l.OwnerHostname = hostname.String
+		l.OwnerPID = int(pid.Int64)
+		l.AcquiredAt = acquiredAt.Time
+		l.LastHeartbeatAt = heartbeatAt.Time
+		l.RecordVersionNumber = rvn.Int64
+		l.ExpiresAt = leaseExpiry(start, leaseRemaining)
+		locks = append(locks, &l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, typedError(err, "cannot list locks")
+	}
+	return locks, nil
+}
+
+// ForceRelease deletes the named lock entry along with its shared locks,
+// regardless of who holds them, and wakes up the clients waiting for it. The
+// former holders find out they lost the lock on their next heartbeat. It
+// returns ErrLockNotFound if there is nothing to release.
+func (c *Client) ForceRelease(ctx context.Context, name string) error {
+	if c.advisory {
+		return ErrNotSupportedWithAdvisoryLocks
+	}
+	return c.retry(func() error { return c.storeForceRelease(ctx, name) })
+}
+
+func (c *Client) storeForceRelease(ctx context.Context, name string) error {
+	ctx, cancel := context.WithTimeout(ctx, c.leaseDuration)
+	defer cancel()
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return typedError(err, "cannot create transaction for forced lock release")
+	}
+	var affected int64
+	for _, table := range []string{c.tableName, c.holdersTableName()} {
+		result, err := tx.ExecContext(ctx, `DELETE FROM `+table+` WHERE "name" = $1`, name)
+		if err != nil {
+			return typedError(err, "cannot run query to delete lock")
+		}
+		n, err := result.RowsAffected()
+		if err != nil {
+			return typedError(err, "cannot confirm whether the lock has been deleted")
+		}
+		affected += n
+	}
+	if affected == 0 {
+		return ErrLockNotFound
+	}
+	if err := c.recordHistory(ctx, tx, HistoryForceRelease, name, 0, ""); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, c.tableName, name); err != nil {
+		return typedError(err, "cannot run query to notify lock release")
+	}
+	if err := tx.Commit(); err != nil {
+		return typedError(err, "cannot commit forced lock release")
+	}
+	return nil
+}
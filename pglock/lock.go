@@ -18,6 +18,7 @@ package pglock
 
 import (
 	"context"
+	"database/sql"
 	"sync"
 	"time"
 )
@@ -38,10 +39,15 @@ type Lock struct {
 	data          []byte
 	failIfLocked  bool
 	keepOnRelease bool
+	shared        bool
+
+	conn        *sql.Conn
+	advisoryKey int64
 
 	mu                  sync.Mutex
 	isReleased          bool
 	recordVersionNumber int64
+	expiresAt           time.Time
 }
 
 // Data returns the content of the lock, if any is available.
@@ -79,6 +85,22 @@ func (l *Lock) RecordVersionNumber() int64 {
 	return l.recordVersionNumber
 }
 
+// IsShared indicates whether this is a shared lock, acquired with
+// AcquireShared.
+func (l *Lock) IsShared() bool {
+	return l.shared
+}
+
+// ExpiresAt returns when the lease of the lock expires unless it is renewed by
+// a heartbeat. The expiry is kept by the database clock and translated to the
+// local one. It is the zero time if the lease expiry is unknown, like in entries
+// written by older versions of this package.
+func (l *Lock) ExpiresAt() time.Time {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.expiresAt
+}
+
 // LockOption reconfigures how the lock behaves on acquire and release.
 type LockOption func(*Lock)
 
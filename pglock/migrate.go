@@ -0,0 +1,162 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"database/sql"
+	"strings"
+
+	"golang.org/x/xerrors"
+)
+
+type column struct {
+	name       string
+	definition string
+}
+
+// lockTableColumns describes the lock table. New columns must be appended at
+// the end and be nullable, so Migrate can add them to existing tables.
+var lockTableColumns = []column{
+	{"name", "CHARACTER VARYING(255) PRIMARY KEY"},
+	{"record_version_number", "BIGINT"},
+	{"data", "BYTEA"},
+	{"owner", "CHARACTER VARYING(255)"},
+	{"lease_expires_at", "TIMESTAMP WITH TIME ZONE"},
+	{"owner_hostname", "CHARACTER VARYING(255)"},
+	{"owner_pid", "INTEGER"},
+	{"acquired_at", "TIMESTAMP WITH TIME ZONE"},
+	{"last_heartbeat_at", "TIMESTAMP WITH TIME ZONE"},
+}
+
+func (c *Client) lockTableDDL(ifNotExists string) string {
+	columns := make([]string, len(lockTableColumns))
+	for i, col := range lockTableColumns {
+		columns[i] = col.name + " " + col.definition
+	}
+	return `CREATE TABLE ` + ifNotExists + c.tableName + ` (
+			` + strings.Join(columns, ",\n\t\t\t") + `
+		);`
+}
+
+func (c *Client) sequenceDDL(ifNotExists string) string {
+	return `CREATE SEQUENCE ` + ifNotExists + c.tableName + `_rvn OWNED BY ` + c.tableName + `.record_version_number`
+}
+
+func (c *Client) holdersTableDDL(ifNotExists string) string {
+	return `CREATE TABLE ` + ifNotExists + c.holdersTableName() + ` (
+			name CHARACTER VARYING(255),
+			record_version_number BIGINT,
+			owner CHARACTER VARYING(255),
+			lease_expires_at TIMESTAMP WITH TIME ZONE NOT NULL,
+			PRIMARY KEY (name, record_version_number)
+		);`
+}
+
+func (c *Client) historyTableDDL(ifNotExists string) []string {
+	return []string{
+		`CREATE TABLE ` + ifNotExists + c.historyTableName() + ` (
+			id BIGSERIAL PRIMARY KEY,
+			name CHARACTER VARYING(255) NOT NULL,
+			event CHARACTER VARYING(32) NOT NULL,
+			owner CHARACTER VARYING(255),
+			owner_hostname CHARACTER VARYING(255),
+			owner_pid INTEGER,
+			record_version_number BIGINT,
+			previous_owner CHARACTER VARYING(255),
+			created_at TIMESTAMP WITH TIME ZONE NOT NULL DEFAULT now()
+		);`,
+		`CREATE INDEX ` + ifNotExists + c.historyTableName() + `_name ON ` + c.historyTableName() + ` (name, id)`,
+	}
+}
+
+// Migrate brings the lock table to the schema expected by this version of the
+// client: it creates the table if it does not exist, or adds the columns,
+// sequence and auxiliary tables that are missing from a table created by an
+// older version. The history table is created when the client is configured
+// WithHistory. All the steps run in a single transaction, and it is safe to
+// call Migrate several times, or from several clients at once.
+func (c *Client) Migrate(ctx context.Context) error {
+	tx, err := c.db.BeginTx(ctx, nil)
+	if err != nil {
+		return xerrors.Errorf("cannot create transaction for migration: %w", err)
+	}
+	defer tx.Rollback()
+	// Concurrent migrations would race to add the same columns.
+	if _, err := tx.ExecContext(ctx, `SELECT pg_advisory_xact_lock($1)`, c.advisoryKey("pglock-migrate")); err != nil {
+		return xerrors.Errorf("cannot lock the database for migration: %w", err)
+	}
+	existing, err := existingColumns(ctx, tx, c.tableName)
+	if err != nil {
+		return xerrors.Errorf("cannot read the schema of the lock table: %w", err)
+	}
+	var cmds []string
+	if len(existing) == 0 {
+		cmds = append(cmds, c.lockTableDDL(""))
+	} else {
+		for _, col := range lockTableColumns {
+			if !existing[col.name] {
+				cmds = append(cmds, `ALTER TABLE `+c.tableName+` ADD COLUMN `+col.name+` `+col.definition)
+			}
+		}
+	}
+	cmds = append(cmds,
+		c.sequenceDDL("IF NOT EXISTS "),
+		c.holdersTableDDL("IF NOT EXISTS "),
+	)
+	if c.history {
+		cmds = append(cmds, c.historyTableDDL("IF NOT EXISTS ")...)
+	}
+	for _, cmd := range cmds {
+		c.log.Println("migrate:", cmd)
+		if _, err := tx.ExecContext(ctx, cmd); err != nil {
+			return xerrors.Errorf("cannot migrate the database: %w", err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return xerrors.Errorf("cannot commit migration: %w", err)
+	}
+	return nil
+}
+
+// existingColumns returns the columns of the given table, which is empty if
+// the table does not exist.
+func existingColumns(ctx context.Context, tx *sql.Tx, tableName string) (map[string]bool, error) {
+	rows, err := tx.QueryContext(ctx, `
+		SELECT
+			"attname"
+		FROM
+			pg_attribute
+		WHERE
+			"attrelid" = to_regclass($1)
+			AND "attnum" > 0
+			AND NOT "attisdropped"
+	`, tableName)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
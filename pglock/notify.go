@@ -0,0 +1,143 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"sync"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+const (
+	listenerMinReconnectInterval = time.Second
+	listenerMaxReconnectInterval = time.Minute
+)
+
+// WithListener makes the client wait for locks using PostgreSQL's
+// LISTEN/NOTIFY: released locks are announced on a channel named after the
+// lock table, and the client opens a connection to the given data source to
+// listen to it. Waiters are then woken up as soon as the lock they want is
+// released, instead of sleeping for a whole lease. Call Close to stop
+// listening.
+func WithListener(dsn string) ClientOption {
+	return func(c *Client) { c.listenerDSN = dsn }
+}
+
+// releaseNotifier wakes up the waiters of the locks announced as released on
+// the notification channel of the lock table.
+type releaseNotifier struct {
+	listener *pq.Listener
+
+	mu      sync.Mutex
+	waiters map[string]map[chan struct{}]struct{}
+}
+
+func (c *Client) startListener() {
+	n := &releaseNotifier{
+		waiters: make(map[string]map[chan struct{}]struct{}),
+	}
+	n.listener = pq.NewListener(c.listenerDSN, listenerMinReconnectInterval, listenerMaxReconnectInterval,
+		func(ev pq.ListenerEventType, err error) {
+			if err != nil {
+				c.log.Println("listener event:", ev, err)
+			}
+			if ev == pq.ListenerEventConnected {
+				// Releases announced before the first connection
+				// were missed, so everyone should check their
+				// locks again.
+				n.wakeAll()
+			}
+		})
+	c.notifier = n
+	go c.listen(n)
+}
+
+func (c *Client) listen(n *releaseNotifier) {
+	// Waiters do not depend on when the channel is actually listened to:
+	// until then they fall back to sleeping, and they are all woken up on
+	// every connection and reconnection of the listener.
+	if err := n.listener.Listen(c.tableName); err != nil {
+		c.log.Println("cannot listen to lock releases:", err)
+		return
+	}
+	for notification := range n.listener.Notify {
+		if notification == nil {
+			// The connection was reestablished and notifications
+			// might have been lost, so everyone should check
+			// their locks again.
+			n.wakeAll()
+			continue
+		}
+		n.wake(notification.Extra)
+	}
+}
+
+// waitRelease registers interest in the release of any of the named locks.
+// The returned channel receives a value once a release is announced; it is nil
+// when the client does not listen to notifications. The returned function must
+// be called once the caller stops waiting.
+func (c *Client) waitRelease(names ...string) (<-chan struct{}, func()) {
+	n := c.notifier
+	if n == nil {
+		return nil, func() {}
+	}
+	ch := make(chan struct{}, 1)
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, name := range names {
+		if n.waiters[name] == nil {
+			n.waiters[name] = make(map[chan struct{}]struct{})
+		}
+		n.waiters[name][ch] = struct{}{}
+	}
+	return ch, func() {
+		n.mu.Lock()
+		defer n.mu.Unlock()
+		for _, name := range names {
+			delete(n.waiters[name], ch)
+			if len(n.waiters[name]) == 0 {
+				delete(n.waiters, name)
+			}
+		}
+	}
+}
+
+func (n *releaseNotifier) wake(name string) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for ch := range n.waiters[name] {
+		signal(ch)
+	}
+}
+
+func (n *releaseNotifier) wakeAll() {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	for _, waiters := range n.waiters {
+		for ch := range waiters {
+			signal(ch)
+		}
+	}
+}
+
+func signal(ch chan struct{}) {
+	select {
+	case ch <- struct{}{}:
+	default:
+	}
+}
@@ -0,0 +1,117 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+)
+
+// AcquireSemaphore attempts to grab one of the permits of the named semaphore,
+// wait until it succeeds or the context is done. It returns ErrNotAcquired if
+// the context is canceled before a permit is acquired. With FailIfLocked, it
+// returns ErrNotAcquired along with the last permit tried when all of them are
+// taken, like Acquire does.
+//
+// Each permit is a lock entry named after the semaphore and the permit number,
+// under a prefix that lock names cannot use (for instance,
+// "pglock.semaphore#name#0"). Permits are leased, heartbeated and released like
+// any other lock; Close on the returned lock gives the permit back. All the
+// callers of a semaphore must use the same number of permits.
+func (c *Client) AcquireSemaphore(ctx context.Context, name string, permits int, opts ...LockOption) (*Lock, error) {
+	if permits < 1 {
+		return nil, ErrNoPermits
+	}
+	probe := &Lock{}
+	for _, opt := range opts {
+		opt(probe)
+	}
+	if err := c.checkAdvisoryLock(probe); err != nil {
+		return nil, err
+	}
+	names := make([]string, permits)
+	for i := range names {
+		names[i] = permitName(name, i)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			return nil, ErrNotAcquired
+		default:
+		}
+		released, stopWaiting := c.waitRelease(names...)
+		l, expiresAt, err := c.tryAcquirePermit(ctx, names, opts)
+		if err == nil {
+			stopWaiting()
+			return l, nil
+		} else if l.failIfLocked && err == ErrNotAcquired {
+			stopWaiting()
+			c.log.Println("not acquired, exit")
+			return l, err
+		} else if err != ErrNotAcquired {
+			stopWaiting()
+			return nil, err
+		}
+		err = c.waitAcquire(ctx, l, expiresAt, released)
+		stopWaiting()
+		if err != nil {
+			return nil, err
+		}
+	}
+}
+
+// tryAcquirePermit grabs the first free permit. When all of them are taken, it
+// returns ErrNotAcquired along with when the first of them expires.
+func (c *Client) tryAcquirePermit(ctx context.Context, names []string, opts []LockOption) (*Lock, time.Time, error) {
+	var (
+		l         *Lock
+		expiresAt time.Time
+	)
+	for _, name := range names {
+		l = c.newLock(ctx, name, opts)
+		err := c.retry(func() error { return c.tryAcquire(ctx, l) })
+		if err == nil {
+			return l, time.Time{}, nil
+		}
+		l.heartbeatCancel()
+		if err != ErrNotAcquired {
+			return l, time.Time{}, err
+		}
+		if e := l.ExpiresAt(); expiresAt.IsZero() || (!e.IsZero() && e.Before(expiresAt)) {
+			expiresAt = e
+		}
+	}
+	c.log.Println("no permits available:", len(names))
+	return l, expiresAt, ErrNotAcquired
+}
+
+// permitNamePrefix prefixes the names of the lock entries of semaphore
+// permits, so they do not collide with the locks acquired by name.
+const permitNamePrefix = "pglock.semaphore#"
+
+func permitName(name string, i int) string {
+	return fmt.Sprintf("%s%s#%d", permitNamePrefix, name, i)
+}
+
+func checkLockName(name string) error {
+	if strings.HasPrefix(name, permitNamePrefix) {
+		return ErrReservedName
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+/*
+Copyright 2020 github.com/ucirello
+
+Licensed under the Apache License, Version 2.0 (the "License");
+you may not use this file except in compliance with the License.
+You may obtain a copy of the License at
+
+    http://www.apache.org/licenses/LICENSE-2.0
+
+Unless required by applicable law or agreed to in writing, software
+distributed under the License is distributed on an "AS IS" BASIS,
+WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+See the License for the specific language governing permissions and
+limitations under the License.
+*/
+
+package pglock
+
+import (
+	"context"
+	"database/sql"
+	"time"
+)
+
+// AcquireShared attempts to grab a shared lock with the given key name and
+// wait until it succeeds.
+func (c *Client) AcquireShared(name string, opts ...LockOption) (*Lock, error) {
+	return c.AcquireSharedContext(context.Background(), name, opts...)
+}
+
+// AcquireSharedContext attempts to grab a shared lock with the given key name,
+// wait until it succeeds or the context is done. Any number of shared locks can
+// be held for the same name at once, as long as no one holds the exclusive lock
+// acquired with Acquire. Each holder is recorded in an auxiliary table and
+// heartbeated on its own, so the shared locks of crashed clients expire. The
+// options WithData, KeepOnRelease and ReplaceData are ignored.
+func (c *Client) AcquireSharedContext(ctx context.Context, name string, opts ...LockOption) (*Lock, error) {
+	if err := checkLockName(name); err != nil {
+		return nil, err
+	}
+	l := c.newLock(ctx, name, opts)
+	l.shared = true
+	return c.acquire(ctx, l)
+}
+
+func (c *Client) holdersTableName() string {
+	return c.tableName + "_holders"
+}
+
+func (c *Client) storeAcquireShared(ctx context.Context, l *Lock) error {
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	start := time.Now()
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return typedError(err, "cannot create transaction for shared lock acquisition")
+	}
+	rowExclusive := tx.QueryRowContext(ctx, `
+		SELECT
+			"owner", `+leaseRemainingColumn+`
+		FROM
+			`+c.tableName+`
+		WHERE
+			"name" = $1
+			AND "record_version_number" IS NOT NULL
+			AND ("lease_expires_at" IS NULL OR "lease_expires_at" >= now())
+	`, l.name)
+	var exclusiveOwner sql.NullString
+	var leaseRemaining sql.NullFloat64
+	err = rowExclusive.Scan(&exclusiveOwner, &leaseRemaining)
+	if err == nil {
+		l.owner = exclusiveOwner.String
+		l.expiresAt = leaseExpiry(start, leaseRemaining)
+		return ErrNotAcquired
+	} else if err != sql.ErrNoRows {
+		return typedError(err, "cannot load information for shared lock acquisition")
+	}
+	rvn, err := c.getNextRVN(ctx, tx)
+	if err != nil {
+		return typedError(err, "cannot run query to read record version number")
+	}
+	_, err = tx.ExecContext(ctx, `
+		DELETE FROM
+			`+c.holdersTableName()+`
+		WHERE
+			"name" = $1
+			AND "lease_expires_at" < now()
+	`, l.name)
+	if err != nil {
+		return typedError(err, "cannot run query to delete expired shared locks")
+	}
+	_, err = tx.ExecContext(ctx, `
+		INSERT INTO `+c.holdersTableName()+`
+			("name", "record_version_number", "owner", "lease_expires_at")
+		VALUES
+			($1, $2, $3, now() + make_interval(secs => $4))
+	`, l.name, rvn, c.owner, l.leaseDuration.Seconds())
+	if err != nil {
+		return typedError(err, "cannot run query to acquire shared lock")
+	}
+	if err := tx.Commit(); err != nil {
+		return typedError(err, "cannot commit shared lock acquisition")
+	}
+	l.owner = c.owner
+	l.recordVersionNumber = rvn
+	l.expiresAt = start.Add(l.leaseDuration)
+	return nil
+}
+
+func (c *Client) storeHeartbeatShared(ctx context.Context, l *Lock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	start := time.Now()
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return typedError(err, "cannot create transaction for shared lock heartbeat")
+	}
+	rvn, err := c.getNextRVN(ctx, tx)
+	if err != nil {
+		return typedError(err, "cannot run query to read record version number")
+	}
+	// Expired holders are ignored by exclusive locks, so they must not
+	// come back to life.
+	result, err := tx.ExecContext(ctx, `
+		UPDATE
+			`+c.holdersTableName()+`
+		SET
+			"record_version_number" = $3,
+			"lease_expires_at" = now() + make_interval(secs => $4)
+		WHERE
+			"name" = $1
+			AND "record_version_number" = $2
+			AND "lease_expires_at" >= now()
+	`, l.name, l.recordVersionNumber, rvn, l.leaseDuration.Seconds())
+	if err != nil {
+		return typedError(err, "cannot run query to update the heartbeat")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return typedError(err, "cannot confirm whether the lock has been updated for the heartbeat")
+	} else if affected == 0 {
+		l.isReleased = true
+		return ErrLockAlreadyReleased
+	}
+	if err := tx.Commit(); err != nil {
+		return typedError(err, "cannot commit shared lock heartbeat")
+	}
+	l.recordVersionNumber = rvn
+	l.expiresAt = start.Add(l.leaseDuration)
+	return nil
+}
+
+func (c *Client) storeReleaseShared(ctx context.Context, l *Lock) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable})
+	if err != nil {
+		return typedError(err, "cannot create transaction for shared lock release")
+	}
+	result, err := tx.ExecContext(ctx, `
+		DELETE FROM
+			`+c.holdersTableName()+`
+		WHERE
+			"name" = $1
+			AND "record_version_number" = $2
+	`, l.name, l.recordVersionNumber)
+	if err != nil {
+		return typedError(err, "cannot run query to release shared lock")
+	}
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return typedError(err, "cannot confirm whether the shared lock has been released")
+	} else if affected == 0 {
+		l.isReleased = true
+		l.heartbeatCancel()
+		return ErrLockAlreadyReleased
+	}
+	if _, err := tx.ExecContext(ctx, `SELECT pg_notify($1, $2)`, c.tableName, l.name); err != nil {
+		return typedError(err, "cannot run query to notify lock release")
+	}
+	if err := tx.Commit(); err != nil {
+		return typedError(err, "cannot commit shared lock release")
+	}
+	l.isReleased = true
+	l.heartbeatCancel()
+	return nil
+}
+
+// waitSharedHolders blocks until all the shared locks of an exclusive lock
+// are released or expired. While it waits, the exclusive lock is held, which
+// prevents new shared locks from being acquired.
+func (c *Client) waitSharedHolders(ctx context.Context, l *Lock) error {
+	for {
+		released, stopWaiting := c.waitRelease(l.name)
+		var expiresAt time.Time
+		err := c.retry(func() error {
+			var err error
+			expiresAt, err = c.sharedHoldersExpiry(ctx, l)
+			return err
+		})
+		switch {
+		case err != nil:
+		case expiresAt.IsZero():
+		case l.failIfLocked:
+			err = ErrNotAcquired
+		default:
+			err = c.waitAcquire(ctx, l, expiresAt, released)
+			if err == nil && l.IsReleased() {
+				err = ErrLockAlreadyReleased
+			}
+			if err == nil {
+				stopWaiting()
+				continue
+			}
+		}
+		stopWaiting()
+		return err
+	}
+}
+
+// sharedHoldersExpiry returns when the last of the live shared locks of the
+// named lock expires, or the zero time if there are none.
+func (c *Client) sharedHoldersExpiry(ctx context.Context, l *Lock) (time.Time, error) {
+	ctx, cancel := context.WithTimeout(ctx, l.leaseDuration)
+	defer cancel()
+	start := time.Now()
+	// The check runs in a serializable transaction so that it conflicts
+	// with shared lock acquisitions that did not see the exclusive lock.
+	tx, err := c.db.BeginTx(ctx, &sql.TxOptions{Isolation: sql.LevelSerializable, ReadOnly: true})
+	if err != nil {
+		return time.Time{}, typedError(err, "cannot create transaction for shared locks check")
+	}
+	row := tx.QueryRowContext(ctx, `
+		SELECT
+			EXTRACT(EPOCH FROM max("lease_expires_at") - now())
+		FROM
+			`+c.holdersTableName()+`
+		WHERE
+			"name" = $1
+			AND "lease_expires_at" >= now()
+	`, l.name)
+	var leaseRemaining sql.NullFloat64
+	if err := row.Scan(&leaseRemaining); err != nil {
+		return time.Time{}, typedError(err, "cannot load information about shared locks")
+	}
+	if err := tx.Commit(); err != nil {
+		return time.Time{}, typedError(err, "cannot commit shared locks check")
+	}
+	return leaseExpiry(start, leaseRemaining), nil
+}
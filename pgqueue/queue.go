@@ -20,6 +20,7 @@ import (
 	"fmt"
 	"io"
 	"math/big"
+	"sort"
 	"sync"
 	"time"
 
@@ -47,6 +48,10 @@ var ErrInvalidDuration = errors.New("invalid duration")
 // current message pointer can no longer be used to update it.
 var ErrMessageExpired = errors.New("message expired")
 
+// ErrInvalidBatchSize indicates the number of messages requested in a batch
+// must be at least one.
+var ErrInvalidBatchSize = errors.New("invalid batch size")
+
 // ErrDeadletterQueueDisabled indicates that is not possible to dump messages
 // from the target deadletter queue because its support has been disabled.
 var ErrDeadletterQueueDisabled = errors.New("deadletter queue disabled")
@@ -341,7 +346,9 @@ func (c *Client) DumpDeadLetterQueue(queue string, w io.Writer) error {
 	return rows.Err()
 }
 
-// CreateTable prepares the underlying table for the queue system.
+// CreateTable prepares the underlying table for the queue system. Tables
+// created by older versions of this package are upgraded with the columns they
+// lack; up to date tables are left untouched.
 func (c *Client) CreateTable() error {
 	_, err := c.db.Exec(`
 		CREATE SEQUENCE IF NOT EXISTS ` + pq.QuoteIdentifier(c.tableName+"_rvn") + ` AS BIGINT CYCLE;
@@ -352,14 +359,73 @@ func (c *Client) CreateTable() error {
 			state VARCHAR,
 			deliveries INT NOT NULL DEFAULT 0,
 			leased_until TIMESTAMP WITHOUT TIME ZONE,
+			visible_after TIMESTAMP WITH TIME ZONE,
+			priority INT NOT NULL DEFAULT 0,
+			metadata JSONB,
+			enqueued_at TIMESTAMP WITH TIME ZONE DEFAULT NOW(),
 			content BYTEA
 		);
+	`)
+	if err != nil {
+		return err
+	}
+	if err := c.addMissingColumns(); err != nil {
+		return err
+	}
+	_, err = c.db.Exec(`
 		CREATE INDEX IF NOT EXISTS ` + pq.QuoteIdentifier(c.tableName+"_pop") + ` ON ` + pq.QuoteIdentifier(c.tableName) + ` (queue, state);
 		CREATE INDEX IF NOT EXISTS ` + pq.QuoteIdentifier(c.tableName+"_vacuum") + ` ON ` + pq.QuoteIdentifier(c.tableName) + ` (queue, state, deliveries, leased_until);
+		CREATE INDEX IF NOT EXISTS ` + pq.QuoteIdentifier(c.tableName+"_priority") + ` ON ` + pq.QuoteIdentifier(c.tableName) + ` (queue, state, priority DESC, id ASC);
 	`)
 	return err
 }
 
+// addedColumns are the columns missing from the tables created by older
+// versions of this package, along with how to add them. Existing messages get
+// no enqueue time.
+var addedColumns = []struct{ name, definition string }{
+	{"visible_after", "ADD COLUMN IF NOT EXISTS visible_after TIMESTAMP WITH TIME ZONE"},
+	{"priority", "ADD COLUMN IF NOT EXISTS priority INT NOT NULL DEFAULT 0"},
+	{"metadata", "ADD COLUMN IF NOT EXISTS metadata JSONB"},
+	{"enqueued_at", "ADD COLUMN IF NOT EXISTS enqueued_at TIMESTAMP WITH TIME ZONE, ALTER COLUMN enqueued_at SET DEFAULT NOW()"},
+}
+
+// addMissingColumns alters the table only when it lacks some of the columns,
+// as every ALTER TABLE holds an exclusive lock on the table and blocks the
+// queues using it.
+func (c *Client) addMissingColumns() error {
+	rows, err := c.db.Query(`
+		SELECT column_name
+		FROM information_schema.columns
+		WHERE table_schema = current_schema() AND table_name = $1
+	`, c.tableName)
+	if err != nil {
+		return fmt.Errorf("cannot load table columns: %w", err)
+	}
+	defer rows.Close()
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var column string
+		if err := rows.Scan(&column); err != nil {
+			return fmt.Errorf("cannot parse table column: %w", err)
+		}
+		columns[column] = true
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("cannot load table columns: %w", err)
+	}
+	for _, added := range addedColumns {
+		if columns[added.name] {
+			continue
+		}
+		_, err := c.db.Exec(`ALTER TABLE ` + pq.QuoteIdentifier(c.tableName) + ` ` + added.definition)
+		if err != nil {
+			return fmt.Errorf("cannot add column %s: %w", added.name, err)
+		}
+	}
+	return nil
+}
+
 // VacuumStats reports the consequences of the clean up.
 type VacuumStats struct {
 	// LastRun indicates the time of the lastest vacuum cycle.
@@ -525,6 +591,7 @@ func (q *Queue) Watch(lease time.Duration) *Watcher {
 		queue:         q,
 		notifications: make(chan struct{}, 1),
 		lease:         lease,
+		pingFrequency: missedNotificationFrequency,
 	}
 	q.client.subscribe(w.notifications, q.queue)
 	return w
@@ -535,19 +602,27 @@ func (q *Queue) Watch(lease time.Duration) *Watcher {
 // is not marked as Done by the lease time, it is returned to the queue. Lease
 // duration must be multiple of milliseconds.
 func (q *Queue) Reserve(lease time.Duration) (*Message, error) {
+	msgs, err := q.ReserveN(1, lease)
+	if err != nil {
+		return nil, err
+	}
+	return msgs[0], nil
+}
+
+// ReserveN retrieves up to n pending messages from the queue in a single round
+// trip, in the same order Reserve would. Each message is leased as in Reserve.
+// If the queue is empty, it returns ErrEmptyQueue.
+func (q *Queue) ReserveN(n int, lease time.Duration) ([]*Message, error) {
 	if q.isClosed() {
 		return nil, ErrAlreadyClosed
 	}
+	if n < 1 {
+		return nil, ErrInvalidBatchSize
+	}
 	if err := validDuration(lease); err != nil {
 		return nil, err
 	}
-	var (
-		id          uint64
-		content     []byte
-		leasedUntil time.Time
-		rvn         int64
-	)
-	row := q.client.db.QueryRow(`
+	rows, err := q.client.db.Query(`
 		UPDATE `+pq.QuoteIdentifier(q.client.tableName)+`
 		SET
 			rvn = nextval(`+pq.QuoteLiteral(q.client.tableName+"_rvn")+`),
@@ -563,29 +638,178 @@ func (q *Queue) Reserve(lease time.Duration) (*Message, error) {
 				WHERE
 					queue = $3
 					AND state = $4
+					AND (visible_after IS NULL OR visible_after <= NOW())
 				ORDER BY
+					priority DESC,
 					id ASC
-				LIMIT 1
+				LIMIT $5
 				FOR UPDATE SKIP LOCKED
 			)
-		RETURNING id, content, leased_until, rvn
-	`, InProgress, lease.String(), q.queue, New)
-	if err := row.Scan(&id, &content, &leasedUntil, &rvn); err != nil && err != sql.ErrNoRows {
+		RETURNING id, content, leased_until, rvn, priority, metadata, deliveries, enqueued_at
+	`, InProgress, lease.String(), q.queue, New, n)
+	if err != nil {
 		return nil, fmt.Errorf("cannot read message: %w", err)
-	} else if err == sql.ErrNoRows {
+	}
+	defer rows.Close()
+	type reservedMessage struct {
+		*Message
+		priority int
+	}
+	var reserved []reservedMessage
+	for rows.Next() {
+		var (
+			r          = reservedMessage{Message: &Message{client: q.client}}
+			metadata   []byte
+			enqueuedAt sql.NullTime
+		)
+		if err := rows.Scan(&r.id, &r.Content, &r.LeasedUntil, &r.rvn, &r.priority, &metadata, &r.deliveries, &enqueuedAt); err != nil {
+			return nil, fmt.Errorf("cannot read message: %w", err)
+		}
+		if len(metadata) > 0 {
+			if err := json.Unmarshal(metadata, &r.headers); err != nil {
+				return nil, fmt.Errorf("cannot parse message metadata: %w", err)
+			}
+		}
+		r.enqueuedAt = enqueuedAt.Time
+		reserved = append(reserved, r)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("cannot read message: %w", err)
+	}
+	if len(reserved) == 0 {
 		return nil, ErrEmptyQueue
 	}
-	return &Message{
-		id:          id,
-		Content:     content,
-		LeasedUntil: leasedUntil,
-		client:      q.client,
-		rvn:         rvn,
-	}, nil
+	// RETURNING does not keep the order of the subquery.
+	sort.Slice(reserved, func(i, j int) bool {
+		a, b := reserved[i], reserved[j]
+		if a.priority != b.priority {
+			return a.priority > b.priority
+		}
+		return a.id < b.id
+	})
+	msgs := make([]*Message, len(reserved))
+	for i, r := range reserved {
+		msgs[i] = r.Message
+	}
+	return msgs, nil
+}
+
+// PushOption configures the message being pushed.
+type PushOption func(*pushOptions)
+
+type pushOptions struct {
+	priority int
+	headers  map[string]string
+}
+
+// newPushOptions applies the options and encodes the message metadata, which
+// is nil when there is nothing to store.
+func newPushOptions(opts []PushOption) (pushOptions, []byte, error) {
+	var o pushOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if len(o.headers) == 0 {
+		return o, nil, nil
+	}
+	metadata, err := json.Marshal(o.headers)
+	if err != nil {
+		return o, nil, fmt.Errorf("cannot encode message metadata: %w", err)
+	}
+	return o, metadata, nil
+}
+
+// WithPriority sets the priority of the message. Messages with higher priority
+// are delivered first, and messages with the same priority are delivered in
+// the order they were pushed. The default priority is zero.
+func WithPriority(priority int) PushOption {
+	return func(o *pushOptions) {
+		o.priority = priority
+	}
+}
+
+// WithHeader attaches a header to the message, like its content type, trace
+// ID or correlation ID. Headers are stored in the metadata column of the
+// message, and read with Message.Header.
+func WithHeader(key, value string) PushOption {
+	return func(o *pushOptions) {
+		if o.headers == nil {
+			o.headers = make(map[string]string)
+		}
+		o.headers[key] = value
+	}
+}
+
+// WithHeaders attaches all the given headers to the message.
+func WithHeaders(headers map[string]string) PushOption {
+	return func(o *pushOptions) {
+		for k, v := range headers {
+			WithHeader(k, v)(o)
+		}
+	}
 }
 
 // Push enqueues the given content to the target queue.
-func (q *Queue) Push(content []byte) error {
+func (q *Queue) Push(content []byte, opts ...PushOption) error {
+	return q.push(content, nil, nil, opts)
+}
+
+// PushAt enqueues the given content to the target queue, but it is not
+// delivered by Reserve, Pop or Watcher before the given time.
+func (q *Queue) PushAt(content []byte, t time.Time, opts ...PushOption) error {
+	return q.push(content, t, nil, opts)
+}
+
+// PushWithDelay enqueues the given content to the target queue, but it is not
+// delivered by Reserve, Pop or Watcher before the delay has passed, as measured
+// by the database clock. Delay must be multiple of milliseconds.
+func (q *Queue) PushWithDelay(content []byte, delay time.Duration, opts ...PushOption) error {
+	if err := validDuration(delay); err != nil {
+		return err
+	}
+	return q.push(content, nil, delay.String(), opts)
+}
+
+// PushBatch enqueues all the given contents to the target queue with a single
+// statement, and notifies the watchers once. The options apply to every
+// message. If any of the contents is too large, nothing is pushed.
+func (q *Queue) PushBatch(contents [][]byte, opts ...PushOption) error {
+	if q.isClosed() {
+		return ErrAlreadyClosed
+	}
+	if len(contents) == 0 {
+		return nil
+	}
+	for _, content := range contents {
+		if err := q.validMessageLength(content); err != nil {
+			return err
+		}
+	}
+	o, metadata, err := newPushOptions(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := q.client.db.Exec(`
+		INSERT INTO `+pq.QuoteIdentifier(q.client.tableName)+`
+			(queue, state, content, priority, metadata)
+		SELECT
+			$1, $2, batch.content, $3, $4::jsonb
+		FROM
+			unnest($5::bytea[]) WITH ORDINALITY AS batch(content, position)
+		ORDER BY
+			batch.position
+	`, q.queue, New, o.priority, metadata, pq.ByteaArray(contents)); err != nil {
+		return fmt.Errorf("cannot store messages: %w", err)
+	}
+	if _, err := q.client.db.Exec(`NOTIFY ` + pq.QuoteIdentifier(q.client.tableName) + `, ` + pq.QuoteLiteral(q.queue)); err != nil {
+		return fmt.Errorf("cannot send push notification: %w", err)
+	}
+	return nil
+}
+
+// push stores the message, visible either after the given time or after the
+// given interval. If both are nil, the message is visible right away.
+func (q *Queue) push(content []byte, visibleAt, delay interface{}, opts []PushOption) error {
 	if q.isClosed() {
 		return ErrAlreadyClosed
 	}
@@ -593,7 +817,16 @@ func (q *Queue) Push(content []byte) error {
 		return err
 	}
 
-	if _, err := q.client.db.Exec(`INSERT INTO `+pq.QuoteIdentifier(q.client.tableName)+` (queue, state, content) VALUES ($1, $2, $3)`, q.queue, New, content); err != nil {
+	o, metadata, err := newPushOptions(opts)
+	if err != nil {
+		return err
+	}
+	if _, err := q.client.db.Exec(`
+		INSERT INTO `+pq.QuoteIdentifier(q.client.tableName)+`
+			(queue, state, content, visible_after, priority, metadata)
+		VALUES
+			($1, $2, $3, COALESCE($4::timestamptz, NOW() + $5::interval), $6, $7::jsonb)
+	`, q.queue, New, content, visibleAt, delay, o.priority, metadata); err != nil {
 		return fmt.Errorf("cannot store message: %w", err)
 	}
 	if _, err := q.client.db.Exec(`NOTIFY ` + pq.QuoteIdentifier(q.client.tableName) + `, ` + pq.QuoteLiteral(q.queue)); err != nil {
@@ -602,6 +835,29 @@ func (q *Queue) Push(content []byte) error {
 	return nil
 }
 
+// nextVisible reports how long until the earliest delayed message of the
+// queue becomes visible. It is false if there are no delayed messages.
+func (q *Queue) nextVisible() (time.Duration, bool, error) {
+	var seconds sql.NullFloat64
+	row := q.client.db.QueryRow(`
+		SELECT
+			EXTRACT(EPOCH FROM MIN(visible_after) - NOW())
+		FROM
+			`+pq.QuoteIdentifier(q.client.tableName)+`
+		WHERE
+			queue = $1
+			AND state = $2
+			AND visible_after > NOW()
+	`, q.queue, New)
+	if err := row.Scan(&seconds); err != nil {
+		return 0, false, fmt.Errorf("cannot read delayed messages: %w", err)
+	}
+	if !seconds.Valid {
+		return 0, false, nil
+	}
+	return time.Duration(seconds.Float64 * float64(time.Second)), true, nil
+}
+
 func (q *Queue) validMessageLength(content []byte) error {
 	if q.maxMessageLength > 0 && len(content) > q.maxMessageLength {
 		return ErrMessageTooLarge
@@ -631,7 +887,9 @@ func (q *Queue) Pop() ([]byte, error) {
 					WHERE
 						queue = $2
 						AND state = $3
+						AND (visible_after IS NULL OR visible_after <= NOW())
 					ORDER BY
+						priority DESC,
 						id ASC
 					LIMIT 1
 					FOR UPDATE SKIP LOCKED
@@ -672,6 +930,7 @@ type Watcher struct {
 	queue         *Queue
 	notifications chan struct{}
 	lease         time.Duration
+	pingFrequency time.Duration
 	msg           *Message
 	err           error
 }
@@ -694,8 +953,17 @@ func (w *Watcher) Next() bool {
 		unsub()
 		return false
 	}
-	tick := time.NewTicker(missedNotificationFrequency)
+	tick := time.NewTicker(w.pingFrequency)
 	defer tick.Stop()
+	var (
+		due        *time.Timer
+		refreshDue = true
+	)
+	defer func() {
+		if due != nil {
+			due.Stop()
+		}
+	}()
 	for {
 		switch msg, err := w.queue.Reserve(w.lease); err {
 		case ErrEmptyQueue:
@@ -708,8 +976,28 @@ func (w *Watcher) Next() bool {
 			w.err = err
 			return err == nil
 		}
+		if refreshDue {
+			refreshDue = false
+			if due != nil {
+				due.Stop()
+				due = nil
+			}
+			// errors here are left for the next Reserve call to
+			// report, the ticker still wakes the watcher up.
+			if d, ok, err := w.queue.nextVisible(); err == nil && ok {
+				due = time.NewTimer(d)
+			}
+		}
+		var dueC <-chan time.Time
+		if due != nil {
+			dueC = due.C
+		}
 		select {
 		case <-w.notifications:
+			refreshDue = true
+		case <-dueC:
+			due = nil
+			refreshDue = true
 		case <-tick.C:
 			go w.queue.client.listener.Ping()
 		}
@@ -733,6 +1021,37 @@ type Message struct {
 	LeasedUntil time.Time
 	rvn         int64
 	client      *Client
+
+	headers    map[string]string
+	deliveries int
+	enqueuedAt time.Time
+}
+
+// Header returns the value of the given header of the message, or an empty
+// string if the message does not have it.
+func (m *Message) Header(key string) string {
+	return m.headers[key]
+}
+
+// Headers returns a copy of all the headers of the message.
+func (m *Message) Headers() map[string]string {
+	headers := make(map[string]string, len(m.headers))
+	for k, v := range m.headers {
+		headers[k] = v
+	}
+	return headers
+}
+
+// Deliveries reports how many times the message has been delivered, including
+// the current delivery.
+func (m *Message) Deliveries() int {
+	return m.deliveries
+}
+
+// EnqueuedAt reports when the message was pushed, as measured by the database
+// clock. It is zero for messages pushed by older versions of this package.
+func (m *Message) EnqueuedAt() time.Time {
+	return m.enqueuedAt
 }
 
 // Done mark message as done.
@@ -91,4 +91,44 @@ func BenchmarkThroughput(b *testing.B) {
 			}
 		}
 	})
+	const batchSize = 100
+	batch := make([][]byte, batchSize)
+	for i := range batch {
+		batch[i] = msg
+	}
+	pushBatches := func(b *testing.B, queue *Queue) {
+		for i := 0; i < b.N; i += batchSize {
+			n := batchSize
+			if b.N-i < n {
+				n = b.N - i
+			}
+			if err := queue.PushBatch(batch[:n]); err != nil {
+				b.Fatal("cannot push messages:", err)
+			}
+		}
+	}
+	b.Run("pushBatch", func(b *testing.B) {
+		queue := client.Queue("queue-benchmark-pushBatch")
+		defer queue.Close()
+		b.SetBytes(int64(len(msg)))
+		pushBatches(b, queue)
+	})
+	b.Run("pushBatchReserveNDone", func(b *testing.B) {
+		queue := client.Queue("queue-benchmark-pushBatchReserveNDone")
+		defer queue.Close()
+		b.SetBytes(int64(len(msg)))
+		pushBatches(b, queue)
+		for reserved := 0; reserved < b.N; {
+			msgs, err := queue.ReserveN(batchSize, time.Minute)
+			if err != nil {
+				b.Fatal("cannot reserve messages:", err)
+			}
+			for _, msg := range msgs {
+				if err := msg.Done(); err != nil {
+					b.Fatalf("cannot mark message (%d) as done: %s", msg.id, err)
+				}
+			}
+			reserved += len(msgs)
+		}
+	})
 }
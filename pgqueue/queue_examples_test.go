@@ -217,3 +217,32 @@ func Example_vacuum() {
 		log.Fatalln("cannot clean up queue:", err)
 	}
 }
+
+func Example_headers() {
+	client, err := pgqueue.Open(dsn)
+	if err != nil {
+		log.Fatalln("cannot open database connection:", err)
+	}
+	defer client.Close()
+	if err := client.CreateTable(); err != nil {
+		log.Fatalln("cannot create queue table:", err)
+	}
+	queue := client.Queue("example-queue-headers")
+	defer queue.Close()
+	content := []byte("content")
+	if err := queue.Push(content, pgqueue.WithHeader("content-type", "text/plain")); err != nil {
+		log.Fatalln("cannot push message to queue:", err)
+	}
+	r, err := queue.Reserve(1 * time.Minute)
+	if err != nil {
+		log.Fatalln("cannot reserve message from the queue:", err)
+	}
+	fmt.Printf("content-type: %s\n", r.Header("content-type"))
+	fmt.Printf("deliveries: %d\n", r.Deliveries())
+	if err := r.Done(); err != nil {
+		log.Fatalln("cannot mark message as done:", err)
+	}
+	// Output:
+	// content-type: text/plain
+	// deliveries: 1
+}
@@ -98,6 +98,50 @@ func TestDBErrorHandling(t *testing.T) {
 			}
 		})
 	})
+	t.Run("push batch", func(t *testing.T) {
+		t.Run("bad exec", func(t *testing.T) {
+			client, mock := setup()
+			badExec := errors.New("cannot insert messages")
+			mock.ExpectExec("INSERT INTO").WillReturnError(badExec)
+			q := client.Queue("queue")
+			defer q.Close()
+			if err := q.PushBatch([][]byte{nil, nil}); !errors.Is(err, badExec) {
+				t.Errorf("expected error not found: %s", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectation error: %s", err)
+			}
+		})
+	})
+	t.Run("reserveN", func(t *testing.T) {
+		t.Run("bad query", func(t *testing.T) {
+			client, mock := setup()
+			badQuery := errors.New("cannot reserve messages")
+			mock.ExpectQuery("UPDATE").WillReturnError(badQuery)
+			q := client.Queue("queue")
+			defer q.Close()
+			if _, err := q.ReserveN(10, time.Minute); !errors.Is(err, badQuery) {
+				t.Errorf("expected error not found: %s", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectation error: %s", err)
+			}
+		})
+		t.Run("bad scan", func(t *testing.T) {
+			client, mock := setup()
+			mock.ExpectQuery("UPDATE").
+				WillReturnRows(sqlmock.NewRows([]string{"id"}).AddRow(0)).
+				RowsWillBeClosed()
+			q := client.Queue("queue")
+			defer q.Close()
+			if _, err := q.ReserveN(10, time.Minute); err == nil {
+				t.Errorf("expected error not found: %v", err)
+			}
+			if err := mock.ExpectationsWereMet(); err != nil {
+				t.Errorf("unmet expectation error: %s", err)
+			}
+		})
+	})
 	t.Run("dump dead letter queue", func(t *testing.T) {
 		t.Run("bad query", func(t *testing.T) {
 			client, mock := setup()
@@ -529,3 +529,324 @@ func TestDisableDeadletterQueue(t *testing.T) {
 		t.Fatal("queue should be empty:", err)
 	}
 }
+
+func TestDelayedDelivery(t *testing.T) {
+	client, err := Open(dsn, DisableAutoVacuum())
+	if err != nil {
+		t.Fatal("cannot open database connection:", err)
+	}
+	defer client.Close()
+	if err := client.CreateTable(); err != nil {
+		t.Fatal("cannot create queue table:", err)
+	}
+	t.Run("push with delay", func(t *testing.T) {
+		const delay = 2 * time.Second
+		qName := fmt.Sprintf("delayed-queue-%s", time.Now())
+		q := client.Queue(qName)
+		defer q.Close()
+		if err := q.PushWithDelay([]byte("delayed"), delay); err != nil {
+			t.Fatal("cannot push delayed message:", err)
+		}
+		if _, err := q.Pop(); err != ErrEmptyQueue {
+			t.Fatal("delayed message must not be popped before its time:", err)
+		}
+		if _, err := q.Reserve(time.Minute); err != ErrEmptyQueue {
+			t.Fatal("delayed message must not be reserved before its time:", err)
+		}
+		time.Sleep(delay)
+		content, err := q.Pop()
+		if err != nil {
+			t.Fatal("cannot pop delayed message:", err)
+		}
+		if !bytes.Equal(content, []byte("delayed")) {
+			t.Errorf("unexpected message: %s", content)
+		}
+	})
+	t.Run("push at", func(t *testing.T) {
+		qName := fmt.Sprintf("scheduled-queue-%s", time.Now())
+		q := client.Queue(qName)
+		defer q.Close()
+		if err := q.PushAt([]byte("future"), time.Now().Add(time.Hour)); err != nil {
+			t.Fatal("cannot push scheduled message:", err)
+		}
+		if err := q.PushAt([]byte("past"), time.Now().Add(-time.Hour)); err != nil {
+			t.Fatal("cannot push scheduled message:", err)
+		}
+		content, err := q.Pop()
+		if err != nil {
+			t.Fatal("cannot pop past message:", err)
+		}
+		if !bytes.Equal(content, []byte("past")) {
+			t.Errorf("unexpected message: %s", content)
+		}
+		if _, err := q.Pop(); err != ErrEmptyQueue {
+			t.Fatal("future message must not be popped:", err)
+		}
+	})
+	t.Run("watcher wakes up when due", func(t *testing.T) {
+		const delay = 100 * time.Millisecond
+		qName := fmt.Sprintf("delayed-watcher-queue-%s", time.Now())
+		q := client.Queue(qName)
+		defer q.Close()
+		w := q.Watch(time.Minute)
+		// Take the periodic ping out of the picture, so only the due
+		// message timer can wake the watcher up in time.
+		w.pingFrequency = time.Minute
+		if err := q.PushWithDelay([]byte("delayed"), delay); err != nil {
+			t.Fatal("cannot push delayed message:", err)
+		}
+		start := time.Now()
+		if !w.Next() {
+			t.Fatal("cannot watch delayed message:", w.Err())
+		}
+		elapsed := time.Since(start)
+		t.Log("delivered after", elapsed)
+		if elapsed >= 10*time.Second {
+			t.Error("watcher did not wake up when the message became due")
+		}
+		if !bytes.Equal(w.Message().Content, []byte("delayed")) {
+			t.Errorf("unexpected message: %s", w.Message().Content)
+		}
+	})
+	t.Run("bad delay", func(t *testing.T) {
+		q := client.Queue("delayed-queue-bad-delay")
+		defer q.Close()
+		if err := q.PushWithDelay(nil, time.Nanosecond); err != ErrInvalidDuration {
+			t.Error("expected ErrInvalidDuration:", err)
+		}
+	})
+}
+
+func TestPriority(t *testing.T) {
+	client, err := Open(dsn, DisableAutoVacuum())
+	if err != nil {
+		t.Fatal("cannot open database connection:", err)
+	}
+	defer client.Close()
+	if err := client.CreateTable(); err != nil {
+		t.Fatal("cannot create queue table:", err)
+	}
+	qName := fmt.Sprintf("priority-queue-%s", time.Now())
+	q := client.Queue(qName)
+	defer q.Close()
+	pushes := []struct {
+		content  string
+		priority int
+	}{
+		{"bulk-1", 0},
+		{"bulk-2", 0},
+		{"urgent-1", 10},
+		{"low", -1},
+		{"urgent-2", 10},
+		{"bulk-3", 0},
+	}
+	for _, p := range pushes {
+		var opts []PushOption
+		if p.priority != 0 {
+			opts = append(opts, WithPriority(p.priority))
+		}
+		if err := q.Push([]byte(p.content), opts...); err != nil {
+			t.Fatal("cannot push message:", err)
+		}
+	}
+	expected := []string{"urgent-1", "urgent-2", "bulk-1", "bulk-2", "bulk-3", "low"}
+	for i, want := range expected {
+		var got []byte
+		if i%2 == 0 {
+			got, err = q.Pop()
+		} else {
+			var m *Message
+			m, err = q.Reserve(time.Minute)
+			if err == nil {
+				got = m.Content
+				err = m.Done()
+			}
+		}
+		if err != nil {
+			t.Fatal("cannot fetch message:", err)
+		}
+		if string(got) != want {
+			t.Errorf("unexpected message at position %d: got %s, want %s", i, got, want)
+		}
+	}
+	if _, err := q.Pop(); err != ErrEmptyQueue {
+		t.Fatal("queue should be empty:", err)
+	}
+}
+
+func TestBatch(t *testing.T) {
+	client, err := Open(dsn, DisableAutoVacuum())
+	if err != nil {
+		t.Fatal("cannot open database connection:", err)
+	}
+	defer client.Close()
+	if err := client.CreateTable(); err != nil {
+		t.Fatal("cannot create queue table:", err)
+	}
+	qName := fmt.Sprintf("batch-queue-%s", time.Now())
+	q := client.Queue(qName)
+	defer q.Close()
+	w := q.Watch(time.Minute)
+	var batch [][]byte
+	for i := 0; i < 10; i++ {
+		batch = append(batch, []byte(fmt.Sprint("message-", i)))
+	}
+	if err := q.PushBatch(batch); err != nil {
+		t.Fatal("cannot push batch:", err)
+	}
+	if err := q.Push([]byte("urgent"), WithPriority(1)); err != nil {
+		t.Fatal("cannot push message:", err)
+	}
+	if !w.Next() {
+		t.Fatal("watcher missed the batch:", w.Err())
+	}
+	if got := string(w.Message().Content); got != "urgent" {
+		t.Errorf("unexpected first message: %s", got)
+	}
+	msgs, err := q.ReserveN(4, time.Minute)
+	if err != nil {
+		t.Fatal("cannot reserve messages:", err)
+	}
+	if len(msgs) != 4 {
+		t.Fatal("unexpected number of messages:", len(msgs))
+	}
+	for i, m := range msgs {
+		if !bytes.Equal(m.Content, batch[i]) {
+			t.Errorf("unexpected message at position %d: %s", i, m.Content)
+		}
+		if err := m.Done(); err != nil {
+			t.Error("cannot mark message as done:", err)
+		}
+	}
+	msgs, err = q.ReserveN(100, time.Minute)
+	if err != nil {
+		t.Fatal("cannot reserve messages:", err)
+	}
+	if len(msgs) != 6 {
+		t.Fatal("unexpected number of messages:", len(msgs))
+	}
+	if _, err := q.ReserveN(100, time.Minute); err != ErrEmptyQueue {
+		t.Fatal("queue should be empty:", err)
+	}
+	t.Run("validation", func(t *testing.T) {
+		if err := q.PushBatch([][]byte{nil, bytes.Repeat([]byte("A"), DefaultMaxMessageLength+1)}); err != ErrMessageTooLarge {
+			t.Error("expected ErrMessageTooLarge:", err)
+		}
+		if err := q.PushBatch(nil); err != nil {
+			t.Error("empty batches must be ignored:", err)
+		}
+		if _, err := q.ReserveN(0, time.Minute); err != ErrInvalidBatchSize {
+			t.Error("expected ErrInvalidBatchSize:", err)
+		}
+		if _, err := q.Pop(); err != ErrEmptyQueue {
+			t.Error("invalid batches must not push messages:", err)
+		}
+	})
+}
+
+func TestMessageMetadata(t *testing.T) {
+	client, err := Open(dsn, DisableAutoVacuum())
+	if err != nil {
+		t.Fatal("cannot open database connection:", err)
+	}
+	defer client.Close()
+	if err := client.CreateTable(); err != nil {
+		t.Fatal("cannot create queue table:", err)
+	}
+	qName := fmt.Sprintf("metadata-queue-%s", time.Now())
+	q := client.Queue(qName)
+	defer q.Close()
+	start := time.Now()
+	err = q.Push([]byte("content"),
+		WithHeader("content-type", "text/plain"),
+		WithHeaders(map[string]string{"trace-id": "abc", "origin": "test"}),
+	)
+	if err != nil {
+		t.Fatal("cannot push message:", err)
+	}
+	m, err := q.Reserve(time.Minute)
+	if err != nil {
+		t.Fatal("cannot reserve message:", err)
+	}
+	if got := m.Header("content-type"); got != "text/plain" {
+		t.Errorf("unexpected content-type header: %q", got)
+	}
+	if got := m.Header("missing"); got != "" {
+		t.Errorf("unexpected missing header: %q", got)
+	}
+	if got := m.Headers(); len(got) != 3 || got["trace-id"] != "abc" || got["origin"] != "test" {
+		t.Errorf("unexpected headers: %v", got)
+	}
+	if got := m.Deliveries(); got != 1 {
+		t.Errorf("unexpected deliveries count: %d", got)
+	}
+	if enqueuedAt := m.EnqueuedAt(); enqueuedAt.IsZero() || enqueuedAt.Sub(start) > time.Minute || start.Sub(enqueuedAt) > time.Minute {
+		t.Errorf("unexpected enqueue time: %v", enqueuedAt)
+	}
+	if err := m.Release(); err != nil {
+		t.Fatal("cannot release message:", err)
+	}
+	m, err = q.Reserve(time.Minute)
+	if err != nil {
+		t.Fatal("cannot reserve message again:", err)
+	}
+	if got := m.Deliveries(); got != 2 {
+		t.Errorf("unexpected deliveries count after release: %d", got)
+	}
+	if err := m.Done(); err != nil {
+		t.Fatal("cannot mark message as done:", err)
+	}
+	t.Run("no headers", func(t *testing.T) {
+		if err := q.PushBatch([][]byte{[]byte("plain")}); err != nil {
+			t.Fatal("cannot push message:", err)
+		}
+		m, err := q.Reserve(time.Minute)
+		if err != nil {
+			t.Fatal("cannot reserve message:", err)
+		}
+		if got := m.Headers(); len(got) != 0 {
+			t.Errorf("unexpected headers: %v", got)
+		}
+	})
+}
+
+func TestCreateTableUpgrade(t *testing.T) {
+	client, err := Open(dsn, WithCustomTable("legacyqueue"), DisableAutoVacuum())
+	if err != nil {
+		t.Fatal("cannot open database connection:", err)
+	}
+	defer client.Close()
+	_, err = client.db.Exec(`
+		DROP TABLE IF EXISTS legacyqueue;
+		CREATE SEQUENCE IF NOT EXISTS legacyqueue_rvn AS BIGINT CYCLE;
+		CREATE TABLE legacyqueue (
+			id SERIAL PRIMARY KEY,
+			rvn BIGINT DEFAULT nextval('legacyqueue_rvn'),
+			queue VARCHAR,
+			state VARCHAR,
+			deliveries INT NOT NULL DEFAULT 0,
+			leased_until TIMESTAMP WITHOUT TIME ZONE,
+			content BYTEA
+		);
+	`)
+	if err != nil {
+		t.Fatal("cannot create legacy queue table:", err)
+	}
+	for i := 0; i < 2; i++ {
+		if err := client.CreateTable(); err != nil {
+			t.Fatal("cannot upgrade queue table:", err)
+		}
+	}
+	q := client.Queue("legacy-queue")
+	defer q.Close()
+	if err := q.Push([]byte("content"), WithPriority(1), WithHeader("origin", "test")); err != nil {
+		t.Fatal("cannot push message:", err)
+	}
+	m, err := q.Reserve(time.Minute)
+	if err != nil {
+		t.Fatal("cannot reserve message:", err)
+	}
+	if m.Header("origin") != "test" || m.EnqueuedAt().IsZero() {
+		t.Errorf("unexpected message: %v %v", m.Headers(), m.EnqueuedAt())
+	}
+}